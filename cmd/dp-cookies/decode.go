@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+)
+
+// decodedCookie is the typed representation of a single cookie from a Cookie header
+type decodedCookie struct {
+	Name        string      `json:"name"`
+	Known       bool        `json:"known"`
+	Description string      `json:"description,omitempty"`
+	Deprecated  bool        `json:"deprecated,omitempty"`
+	Raw         string      `json:"raw"`
+	Value       interface{} `json:"value,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+func decode(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := fs.Bool("json", false, "write the decoded cookies as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	headers, err := headerLines(fs.Args(), stdin, "Cookie:")
+	if err != nil {
+		return err
+	}
+	if len(headers) == 0 {
+		return errors.New("no cookie header given")
+	}
+
+	cookieList, err := http.ParseCookie(strings.Join(headers, "; "))
+	if err != nil {
+		return err
+	}
+
+	decoded := make([]decodedCookie, 0, len(cookieList))
+	for _, c := range cookieList {
+		decoded = append(decoded, decodeCookie(c))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(decoded)
+	}
+
+	for _, d := range decoded {
+		if err := writeDecoded(stdout, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeCookie(c *http.Cookie) decodedCookie {
+	d := decodedCookie{Name: c.Name, Raw: c.Value}
+
+	definition, ok := cookies.Lookup(c.Name)
+	if !ok {
+		return d
+	}
+
+	d.Known = true
+	d.Description = definition.Description
+	d.Deprecated = definition.Deprecated
+
+	value, err := definition.Decode(c.Value)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.Value = value
+
+	return d
+}
+
+func writeDecoded(w io.Writer, d decodedCookie) error {
+	description := "unknown cookie"
+	if d.Known {
+		description = d.Description
+	}
+	if d.Deprecated {
+		description += ", deprecated"
+	}
+
+	if _, err := fmt.Fprintf(w, "%s (%s)\n  raw:   %s\n", d.Name, description, d.Raw); err != nil {
+		return err
+	}
+
+	switch {
+	case d.Error != "":
+		_, err := fmt.Fprintf(w, "  error: %s\n", d.Error)
+		return err
+	case d.Value != nil:
+		b, err := json.MarshalIndent(d.Value, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "  value: %s\n", b)
+		return err
+	}
+	return nil
+}
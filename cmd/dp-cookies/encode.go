@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+)
+
+func encode(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("expected 'policy' or 'aspect'")
+	}
+
+	w := &headerWriter{header: http.Header{}}
+	var err error
+	switch args[0] {
+	case "policy":
+		err = encodePolicy(w, args[1:])
+	case "aspect":
+		err = encodeAspect(w, args[1:])
+	default:
+		err = fmt.Errorf("unknown cookie type %q, expected 'policy' or 'aspect'", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, h := range w.header.Values("Set-Cookie") {
+		if _, err := fmt.Fprintf(stdout, "Set-Cookie: %s\n", h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodePolicy(w http.ResponseWriter, args []string) error {
+	fs := flag.NewFlagSet("encode policy", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	domain := fs.String("domain", "", "domain of the cookie")
+	policy := cookies.ONSPolicy{}
+	fs.BoolVar(&policy.Essential, "essential", true, "consent to essential cookies")
+	fs.BoolVar(&policy.Settings, "settings", false, "consent to settings cookies")
+	fs.BoolVar(&policy.Usage, "usage", false, "consent to usage cookies")
+	fs.BoolVar(&policy.Campaigns, "campaigns", false, "consent to campaigns cookies")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cookies.SetONSPolicy(w, policy, *domain)  //nolint:staticcheck // encodes a policy, not consent given by a user
+	cookies.SetONSPreferenceIsSet(w, *domain) //nolint:staticcheck // encodes a policy, not consent given by a user
+	return nil
+}
+
+func encodeAspect(w http.ResponseWriter, args []string) error {
+	fs := flag.NewFlagSet("encode aspect", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	domain := fs.String("domain", "", "domain of the cookie")
+	aspectID := fs.String("id", "", "id of the aspect")
+	variant := fs.String("variant", "", "variant to force, 'new' or 'old'")
+	hours := fs.Int("hours", 24, "lifetime in hours of a forced variant")
+	newTime := fs.String("new", "", "time until which the new handler is used")
+	oldTime := fs.String("old", "", "time until which the old handler is used")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *aspectID == "" {
+		return errors.New("an aspect -id is required")
+	}
+
+	var aspect cookies.ABTestCookieAspect
+	switch v := cookies.ABTestVariant(*variant); v {
+	case cookies.ABTestVariantNew, cookies.ABTestVariantOld:
+		aspect = cookies.NewABTestCookieAspect(v, time.Hour*time.Duration(*hours))
+	case "":
+		var err error
+		if aspect.New, err = cookies.ParseCookieTime(*newTime); err != nil {
+			return err
+		}
+		if aspect.Old, err = cookies.ParseCookieTime(*oldTime); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid variant %q, expected 'new' or 'old'", *variant)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/", http.NoBody)
+	if err != nil {
+		return err
+	}
+	cookies.SetABTestCookieAspect(w, req, *aspectID, *domain, aspect)
+	return nil
+}
+
+// headerWriter is a http.ResponseWriter that only collects headers
+type headerWriter struct {
+	header http.Header
+}
+
+func (h *headerWriter) Header() http.Header { return h.header }
+
+func (h *headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (h *headerWriter) WriteHeader(int) {}
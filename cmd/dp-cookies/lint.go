@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+)
+
+// errLintFailed is returned when at least one Set-Cookie header does not match the registry
+var errLintFailed = errors.New("one or more cookies failed linting")
+
+func lint(args []string, stdin io.Reader, stdout io.Writer) error {
+	headers, err := headerLines(args, stdin, "Set-Cookie:")
+	if err != nil {
+		return err
+	}
+	if len(headers) == 0 {
+		return errors.New("no set-cookie header given")
+	}
+
+	failed := false
+	for _, h := range headers {
+		problems := lintHeader(h)
+		if len(problems) == 0 {
+			if _, err := fmt.Fprintf(stdout, "ok: %s\n", h); err != nil {
+				return err
+			}
+			continue
+		}
+
+		failed = true
+		if _, err := fmt.Fprintf(stdout, "fail: %s\n", h); err != nil {
+			return err
+		}
+		for _, p := range problems {
+			if _, err := fmt.Fprintf(stdout, "  - %v\n", p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed {
+		return errLintFailed
+	}
+	return nil
+}
+
+func lintHeader(header string) []error {
+	c, err := http.ParseSetCookie(header)
+	if err != nil {
+		return []error{err}
+	}
+
+	definition, ok := cookies.Lookup(c.Name)
+	if !ok {
+		return []error{fmt.Errorf("unknown cookie %q", c.Name)}
+	}
+
+	return definition.Check(c)
+}
@@ -0,0 +1,88 @@
+// Command dp-cookies decodes, encodes and lints the cookies written by the dp-cookies library.
+//
+// Usage:
+//
+//	dp-cookies decode [-json] [cookie header]
+//	dp-cookies encode policy [-domain d] [-essential] [-settings] [-usage] [-campaigns]
+//	dp-cookies encode aspect [-domain d] -id aspect [-variant new|old] [-hours n] [-new time] [-old time]
+//	dp-cookies lint [set-cookie header...]
+//
+// Headers are read from standard input, one per line, when they are not given as arguments.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `usage:
+  dp-cookies decode [-json] [cookie header]
+  dp-cookies encode policy [-domain d] [-essential] [-settings] [-usage] [-campaigns]
+  dp-cookies encode aspect [-domain d] -id aspect [-variant new|old] [-hours n] [-new time] [-old time]
+  dp-cookies lint [set-cookie header...]
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand named by the first argument and returns the process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "decode":
+		err = decode(args[1:], stdin, stdout)
+	case "encode":
+		err = encode(args[1:], stdout)
+	case "lint":
+		err = lint(args[1:], stdin, stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "dp-cookies %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// headerLines returns the arguments if any were given, otherwise every non-empty line of stdin, with the given
+// header name prefix removed
+func headerLines(args []string, stdin io.Reader, prefix string) ([]string, error) {
+	lines := args
+	if len(lines) == 0 {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) > len(prefix) && strings.EqualFold(line[:len(prefix)], prefix) {
+			line = strings.TrimSpace(line[len(prefix):])
+		}
+		if line != "" {
+			headers = append(headers, line)
+		}
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRun(t *testing.T) {
+	Convey("Given no command", t, func() {
+		var stdout, stderr bytes.Buffer
+
+		Convey("run prints the usage and fails", func() {
+			So(run(nil, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 2)
+			So(stderr.String(), ShouldContainSubstring, "usage:")
+		})
+	})
+
+	Convey("Given an unknown command", t, func() {
+		var stdout, stderr bytes.Buffer
+
+		Convey("run reports the command and fails", func() {
+			So(run([]string{"unknown"}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 2)
+			So(stderr.String(), ShouldContainSubstring, `unknown command "unknown"`)
+		})
+	})
+}
+
+func TestDecode(t *testing.T) {
+	Convey("Given a Cookie header with known, unknown and invalid cookies", t, func() {
+		header := "Cookie: ons_cookie_policy={'essential':true,'settings':true,'usage':false,'campaigns':false}; lang=cy; foo=bar; ons_cookie_message_displayed=maybe"
+		var stdout, stderr bytes.Buffer
+
+		Convey("decode pretty prints each cookie with its typed value or validation error", func() {
+			So(run([]string{"decode", header}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 0)
+			out := stdout.String()
+			So(out, ShouldContainSubstring, "ons_cookie_policy (ONS cookie policy)")
+			So(out, ShouldContainSubstring, `"settings": true`)
+			So(out, ShouldContainSubstring, "lang (language)\n  raw:   cy\n  value: \"cy\"")
+			So(out, ShouldContainSubstring, "foo (unknown cookie)")
+			So(out, ShouldContainSubstring, "ons_cookie_message_displayed (ONS cookie preferences set)\n  raw:   maybe\n  error:")
+		})
+
+		Convey("decode -json writes the cookies as JSON", func() {
+			So(run([]string{"decode", "-json", header}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 0)
+			So(stdout.String(), ShouldContainSubstring, `"name": "lang"`)
+			So(stdout.String(), ShouldContainSubstring, `"known": false`)
+		})
+	})
+
+	Convey("Given a Cookie header on stdin", t, func() {
+		var stdout, stderr bytes.Buffer
+
+		Convey("decode reads the header from stdin", func() {
+			So(run([]string{"decode"}, strings.NewReader("lang=en\n"), &stdout, &stderr), ShouldEqual, 0)
+			So(stdout.String(), ShouldContainSubstring, "lang (language)")
+		})
+	})
+}
+
+func TestEncode(t *testing.T) {
+	Convey("Given a policy", t, func() {
+		var stdout, stderr bytes.Buffer
+
+		Convey("encode policy writes the policy and preferences set cookies", func() {
+			So(run([]string{"encode", "policy", "-domain", "www.ons.gov.uk", "-usage"}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 0)
+			So(stdout.String(), ShouldContainSubstring, "Set-Cookie: ons_cookie_policy={'essential':true,'settings':false,'usage':true,'campaigns':false}; Path=/; Domain=www.ons.gov.uk")
+			So(stdout.String(), ShouldContainSubstring, "Set-Cookie: ons_cookie_message_displayed=true;")
+		})
+	})
+
+	Convey("Given an aspect", t, func() {
+		var stdout, stderr bytes.Buffer
+
+		Convey("encode aspect writes an ab_test cookie", func() {
+			So(run([]string{"encode", "aspect", "-id", "x", "-new", "2021-01-01T15:31:23"}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 0)
+			So(stdout.String(), ShouldStartWith, "Set-Cookie: ab_test=%7B%22x%22%3A%7B%22new%22%3A%222021-01-01T15%3A31%3A23%22")
+		})
+
+		Convey("encode aspect fails without an id", func() {
+			So(run([]string{"encode", "aspect", "-variant", "new"}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 1)
+			So(stderr.String(), ShouldContainSubstring, "an aspect -id is required")
+		})
+
+		Convey("encode aspect fails with an invalid variant", func() {
+			So(run([]string{"encode", "aspect", "-id", "x", "-variant", "both"}, strings.NewReader(""), &stdout, &stderr), ShouldEqual, 1)
+			So(stderr.String(), ShouldContainSubstring, `invalid variant "both"`)
+		})
+	})
+}
+
+func TestLint(t *testing.T) {
+	Convey("Given Set-Cookie headers produced by the library", t, func() {
+		var encoded, stdout, stderr bytes.Buffer
+		So(run([]string{"encode", "policy"}, strings.NewReader(""), &encoded, &stderr), ShouldEqual, 0)
+
+		Convey("lint passes", func() {
+			So(run([]string{"lint"}, &encoded, &stdout, &stderr), ShouldEqual, 0)
+			So(stdout.String(), ShouldStartWith, "ok: ons_cookie_policy=")
+		})
+	})
+
+	Convey("Given Set-Cookie headers which do not match the registry", t, func() {
+		var stdout, stderr bytes.Buffer
+
+		Convey("lint reports each problem and fails", func() {
+			code := run([]string{"lint", "Set-Cookie: access_token=x; Path=/; SameSite=Lax", "foo=bar"}, strings.NewReader(""), &stdout, &stderr)
+			So(code, ShouldEqual, 1)
+			So(stdout.String(), ShouldContainSubstring, "fail: access_token=x; Path=/; SameSite=Lax\n  - same site is Lax, expected Strict\n  - http only is false, expected true")
+			So(stdout.String(), ShouldContainSubstring, "fail: foo=bar\n  - unknown cookie \"foo\"")
+		})
+	})
+}
@@ -3,12 +3,11 @@ package cookies
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"time"
-
-	"github.com/ONSdigital/log.go/v2/log"
 )
 
 type ABTestCookieAspect struct {
@@ -22,6 +21,42 @@ const (
 
 type abTestCookie map[string]ABTestCookieAspect
 
+// ABTestVariant identifies the handler an aspect routes a request to
+type ABTestVariant string
+
+const (
+	// ABTestVariantNew is used when a request is served by the new handler
+	ABTestVariantNew ABTestVariant = "new"
+
+	// ABTestVariantOld is used when a request is served by the old handler
+	ABTestVariantOld ABTestVariant = "old"
+
+	// ABTestVariantNone is used when neither handler would serve a request, i.e. the aspect has expired
+	ABTestVariantNone ABTestVariant = "none"
+)
+
+// NewABTestCookieAspect returns an aspect that routes requests to the given variant for the supplied lifetime
+func NewABTestCookieAspect(variant ABTestVariant, lifetime time.Duration) ABTestCookieAspect {
+	now := Now()
+	if variant == ABTestVariantNew {
+		return ABTestCookieAspect{New: now.Add(lifetime), Old: now}
+	}
+
+	return ABTestCookieAspect{New: now, Old: now.Add(lifetime)}
+}
+
+// Variant reports the handler ServABTest would use for the aspect at the given time
+func (a ABTestCookieAspect) Variant(now time.Time) ABTestVariant {
+	switch {
+	case a.New.After(now):
+		return ABTestVariantNew
+	case a.Old.After(now):
+		return ABTestVariantOld
+	default:
+		return ABTestVariantNone
+	}
+}
+
 // ErrABTestCookieNotFound is used when a/b test cookie isn't found
 var ErrABTestCookieNotFound = errors.New("a/b test cookie not found")
 
@@ -29,47 +64,72 @@ func GetABTestCookieAspect(req *http.Request, aspectID string) ABTestCookieAspec
 	aBTestCookie, err := getABTestCookie(req)
 	switch {
 	case errors.Is(err, ErrABTestCookieNotFound):
-		log.Info(req.Context(), "a/b test cookie not found", log.Data{"aspectID": aspectID})
+		getLogger().Info(req.Context(), "a/b test cookie not found", logData{"aspectID": aspectID})
 		return ABTestCookieAspect{}
 	case err != nil:
-		log.Error(req.Context(), errGettingABTestCookieAspect, err, log.Data{"aspectID": aspectID})
+		getLogger().Error(req.Context(), errGettingABTestCookieAspect, err, logData{"aspectID": aspectID})
 		return ABTestCookieAspect{}
 	}
 
 	return aBTestCookie[aspectID]
 }
 
+// GetABTestCookieAspects returns every aspect held in the a/b test cookie, keyed by aspect ID
+func GetABTestCookieAspects(req *http.Request) (map[string]ABTestCookieAspect, error) {
+	return getABTestCookie(req)
+}
+
+// SetABTestCookieAspect adds or replaces the aspect in the a/b test cookie. The cookie is not written when a privacy
+// signal rejects usage cookies, see GetEffectiveONSPolicy.
 func SetABTestCookieAspect(w http.ResponseWriter, req *http.Request, aspectID, domain string, aspect ABTestCookieAspect) {
+	err := TrySetABTestCookieAspect(w, req, aspectID, domain, aspect)
+	switch {
+	case errors.Is(err, ErrRejectedByPrivacySignal):
+		getLogger().Info(req.Context(), "a/b test cookie not set as rejected by privacy signal", logData{"aspectID": aspectID})
+	case err != nil:
+		getLogger().Error(req.Context(), "error updating a/b test cookie aspect", err, logData{"aspectID": aspectID, "aspect": aspect})
+	}
+}
+
+// TrySetABTestCookieAspect adds or replaces the aspect in the a/b test cookie, returning ErrRejectedByPrivacySignal
+// when a privacy signal rejects usage cookies, or an error if the cookie cannot be read or set
+func TrySetABTestCookieAspect(w http.ResponseWriter, req *http.Request, aspectID, domain string, aspect ABTestCookieAspect) error {
+	if rejectedByPrivacySignal(req, aBTestKey) {
+		return ErrRejectedByPrivacySignal
+	}
+
 	cookie, err := getABTestCookie(req)
 	switch {
 	case errors.Is(err, ErrABTestCookieNotFound):
 		cookie = make(abTestCookie)
 	case err != nil:
-		log.Error(req.Context(), errGettingABTestCookieAspect, err, log.Data{"aspectID": aspectID})
-		return
+		return fmt.Errorf("%s: %w", errGettingABTestCookieAspect, err)
 	}
 	cookie[aspectID] = aspect
 
-	if err = setABTestCookie(w, cookie, domain); err != nil {
-		log.Error(req.Context(), "error updating a/b test cookie aspect", err, log.Data{"aspectID": aspectID, "aspect": aspect})
-	}
+	return setABTestCookie(w, cookie, domain)
 }
 
 func RemoveABTestCookieAspect(w http.ResponseWriter, req *http.Request, aspectID, domain string) {
+	if err := TryRemoveABTestCookieAspect(w, req, aspectID, domain); err != nil {
+		getLogger().Error(req.Context(), "error removing a/b test cookie aspect", err, logData{"aspectID": aspectID})
+	}
+}
+
+// TryRemoveABTestCookieAspect removes the aspect from the a/b test cookie, returning an error if the cookie cannot be
+// read or set. Nothing is written when there is no a/b test cookie.
+func TryRemoveABTestCookieAspect(w http.ResponseWriter, req *http.Request, aspectID, domain string) error {
 	cookie, err := getABTestCookie(req)
 	switch {
 	case errors.Is(err, ErrABTestCookieNotFound):
-		return
+		return nil
 	case err != nil:
-		log.Error(req.Context(), errGettingABTestCookieAspect, err, log.Data{"aspectID": aspectID})
-		return
+		return fmt.Errorf("%s: %w", errGettingABTestCookieAspect, err)
 	}
 
 	delete(cookie, aspectID)
 
-	if err = setABTestCookie(w, cookie, domain); err != nil {
-		log.Error(req.Context(), "error removing a/b test cookie aspect", err, log.Data{"aspectID": aspectID})
-	}
+	return setABTestCookie(w, cookie, domain)
 }
 
 func ServABTest(w http.ResponseWriter, req *http.Request, n, o http.Handler, aspect ABTestCookieAspect) {
@@ -95,8 +155,7 @@ func HandleCookieAndServ(w http.ResponseWriter, req *http.Request, n, o http.Han
 }
 
 func HandleABTestExit(w http.ResponseWriter, req *http.Request, o http.Handler, aspectID, domain string) {
-	now := Now()
-	aspect := ABTestCookieAspect{New: now, Old: now.Add(time.Hour * 24)}
+	aspect := NewABTestCookieAspect(ABTestVariantOld, time.Hour*24)
 
 	SetABTestCookieAspect(w, req, aspectID, domain, aspect)
 
@@ -111,9 +170,7 @@ func setABTestCookie(w http.ResponseWriter, cookie abTestCookie, domain string)
 	path := "/"
 	httpOnly := false
 
-	set(w, aBTestKey, string(b), domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
-
-	return nil
+	return trySet(w, aBTestKey, string(b), domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
 }
 
 func getABTestCookie(req *http.Request) (abTestCookie, error) {
@@ -125,7 +182,16 @@ func getABTestCookie(req *http.Request) (abTestCookie, error) {
 		return abTestCookie{}, err
 	}
 
-	unescapedCookie, err := url.QueryUnescape(rawABTestCookie.Value)
+	cookie, err := parseABTestCookie(rawABTestCookie.Value)
+	if err != nil {
+		recordParseFailure(req.Context(), aBTestKey)
+	}
+	return cookie, err
+}
+
+// parseABTestCookie decodes the url encoded JSON value of an ab_test cookie
+func parseABTestCookie(value string) (abTestCookie, error) {
+	unescapedCookie, err := url.QueryUnescape(value)
 	if err != nil {
 		return abTestCookie{}, err
 	}
@@ -135,20 +201,22 @@ func getABTestCookie(req *http.Request) (abTestCookie, error) {
 	if err != nil {
 		return abTestCookie{}, err
 	}
+	// a JSON null decodes to a nil map, which cannot have aspects added
+	if cookie == nil {
+		cookie = abTestCookie{}
+	}
 
 	return cookie, nil
 }
 
 var DefaultABTestRandomiser = func(percentage int) Randomiser {
 	return func() ABTestCookieAspect {
-		now := Now()
-
 		//nolint:gosec //does not need to be cryptographically secure
 		if rand.Intn(100) < percentage {
-			return ABTestCookieAspect{New: now.Add(time.Hour * 24), Old: now}
+			return NewABTestCookieAspect(ABTestVariantNew, time.Hour*24)
 		}
 
-		return ABTestCookieAspect{New: now, Old: now.Add(time.Hour * 24)}
+		return NewABTestCookieAspect(ABTestVariantOld, time.Hour*24)
 	}
 }
 
@@ -170,22 +238,38 @@ func Handler(abTest bool, newHandler, oldHandler http.Handler, percentage int, a
 // the DefaultABTestRandomiser in the library is sufficient
 // A well known string - the exitNew string -  can be used as a query parameter to the call, in order to definitively chose
 // the old handler
+// When a privacy signal rejects usage cookies the new handler is used, without an aspect being set
 func abTestHandler(newHandler, oldHandler http.Handler, percentage int, aspectID, domain, exitNew string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		now := time.Now().UTC()
+		// the consent is read both here and when the aspect is set, but is only counted once
+		req = withONSPolicyCache(req)
 
 		if _, ok := req.URL.Query()[exitNew]; ok {
+			recordABTest(req.Context(), aspectID, ABTestVariantOld, true)
 			HandleABTestExit(w, req, oldHandler, aspectID, domain)
 			return
 		}
 
+		if rejectedByPrivacySignal(req, aBTestKey) {
+			recordABTest(req.Context(), aspectID, ABTestVariantNew, false)
+			newHandler.ServeHTTP(w, req)
+			return
+		}
+
 		aspect := GetABTestCookieAspect(req, aspectID)
 
 		if (aspect.New.IsZero() && aspect.Old.IsZero()) || (aspect.New.Before(now) && aspect.Old.Before(now)) {
-			HandleCookieAndServ(w, req, newHandler, oldHandler, aspectID, domain, DefaultABTestRandomiser(percentage))
+			randomiser := DefaultABTestRandomiser(percentage)
+			HandleCookieAndServ(w, req, newHandler, oldHandler, aspectID, domain, func() ABTestCookieAspect {
+				aspect := randomiser()
+				recordABTest(req.Context(), aspectID, aspect.Variant(time.Now()), true)
+				return aspect
+			})
 			return
 		}
 
+		recordABTest(req.Context(), aspectID, aspect.Variant(now), false)
 		ServABTest(w, req, newHandler, oldHandler, aspect)
 	})
 }
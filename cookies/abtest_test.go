@@ -2,6 +2,7 @@ package cookies
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -471,3 +472,135 @@ func TestDefaultABTestRandomiserAt100(t *testing.T) {
 		t.Errorf("a percentage of 100%% requires ALL generated aspects to favour the New value. Expected: %d Got %d", iterations, n)
 	}
 }
+
+func TestNewABTestCookieAspect(t *testing.T) {
+	Convey("Given a lifetime of a day", t, func() {
+		lifetime := time.Hour * 24
+
+		Convey("An aspect created for the new variant is served by the new handler", func() {
+			aspect := NewABTestCookieAspect(ABTestVariantNew, lifetime)
+			So(aspect.New.After(time.Now()), ShouldBeTrue)
+			So(aspect.Old.After(time.Now()), ShouldBeFalse)
+			So(aspect.Variant(time.Now()), ShouldEqual, ABTestVariantNew)
+		})
+
+		Convey("An aspect created for the old variant is served by the old handler", func() {
+			aspect := NewABTestCookieAspect(ABTestVariantOld, lifetime)
+			So(aspect.New.After(time.Now()), ShouldBeFalse)
+			So(aspect.Old.After(time.Now()), ShouldBeTrue)
+			So(aspect.Variant(time.Now()), ShouldEqual, ABTestVariantOld)
+		})
+	})
+}
+
+func TestABTestCookieAspectVariant(t *testing.T) {
+	Convey("Given an aspect that has expired", t, func() {
+		aspect := ABTestCookieAspect{New: MustParseCookieTime("2020-06-16T17:28:45"), Old: MustParseCookieTime("2020-06-15T17:28:45")}
+
+		Convey("Variant reports that neither handler would be used", func() {
+			So(aspect.Variant(time.Now()), ShouldEqual, ABTestVariantNone)
+		})
+
+		Convey("Variant reports the variant in use at an earlier time", func() {
+			So(aspect.Variant(MustParseCookieTime("2020-06-15T00:00:00").Time), ShouldEqual, ABTestVariantNew)
+		})
+	})
+
+	Convey("Given a zero value aspect", t, func() {
+		So(ABTestCookieAspect{}.Variant(time.Now()), ShouldEqual, ABTestVariantNone)
+	})
+}
+
+func TestGetABTestCookieAspects(t *testing.T) {
+	Convey("Given a http abTestCookie exists with two aspects", t, func() {
+		c := &http.Cookie{
+			Name:  aBTestKey,
+			Value: url.QueryEscape(fmt.Sprintf(`{%q:{"new":"2020-06-16T17:28:45","old":"2020-06-15T17:28:45"},%q:{"new":"2021-12-31T09:30:00","old":"2022-01-01T09:30:00"}}`, testAspectID, testSecondAspectID)),
+		}
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(c)
+
+		Convey("GetABTestCookieAspects returns both aspects", func() {
+			aspects, err := GetABTestCookieAspects(req)
+			So(err, ShouldBeNil)
+			So(aspects, ShouldHaveLength, 2)
+			So(aspects[testSecondAspectID], ShouldResemble, ABTestCookieAspect{New: MustParseCookieTime("2021-12-31T09:30:00"), Old: MustParseCookieTime("2022-01-01T09:30:00")})
+		})
+	})
+
+	Convey("Given a http abTestCookie does not exist", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+
+		Convey("GetABTestCookieAspects returns ErrABTestCookieNotFound", func() {
+			_, err := GetABTestCookieAspects(req)
+			So(err, ShouldEqual, ErrABTestCookieNotFound)
+		})
+	})
+}
+
+func TestTrySetABTestCookieAspect(t *testing.T) {
+	Convey("Given a request without an a/b test cookie", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		aspect := NewABTestCookieAspect(ABTestVariantNew, time.Hour)
+
+		Convey("The aspect is set", func() {
+			rec := httptest.NewRecorder()
+			So(TrySetABTestCookieAspect(rec, req, testAspectID, testDomain, aspect), ShouldBeNil)
+			So(rec.Result().Cookies(), ShouldHaveLength, 1)
+		})
+
+		Convey("Removing an aspect writes nothing", func() {
+			rec := httptest.NewRecorder()
+			So(TryRemoveABTestCookieAspect(rec, req, testAspectID, testDomain), ShouldBeNil)
+			So(rec.Result().Cookies(), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a corrupt a/b test cookie", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: aBTestKey, Value: "corrupt"})
+
+		Convey("Setting and removing aspects return an error", func() {
+			rec := httptest.NewRecorder()
+			So(TrySetABTestCookieAspect(rec, req, testAspectID, testDomain, ABTestCookieAspect{}), ShouldNotBeNil)
+			So(TryRemoveABTestCookieAspect(rec, req, testAspectID, testDomain), ShouldNotBeNil)
+			So(rec.Result().Cookies(), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an a/b test cookie of null", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: aBTestKey, Value: "null"})
+		aspect := NewABTestCookieAspect(ABTestVariantNew, time.Hour)
+
+		Convey("The aspect is set as if there were no aspects", func() {
+			rec := httptest.NewRecorder()
+			So(TrySetABTestCookieAspect(rec, req, testAspectID, testDomain, aspect), ShouldBeNil)
+			aspects, err := GetABTestCookieAspects(browserRequest(rec))
+			So(err, ShouldBeNil)
+			So(aspects, ShouldHaveLength, 1)
+			So(aspects[testAspectID].New.Unix(), ShouldEqual, aspect.New.Unix())
+		})
+
+		Convey("The a/b test handler serves the request", func() {
+			handler := Handler(true, http.NotFoundHandler(), http.NotFoundHandler(), 50, testAspectID, testDomain, "exit")
+			rec := httptest.NewRecorder()
+			So(func() { handler.ServeHTTP(rec, req) }, ShouldNotPanic)
+			So(rec.Result().Cookies(), ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Given a privacy signal rejecting usage cookies", t, func() {
+		SetConsentConfig(ConsentConfig{HonourGPC: true})
+		Reset(func() { SetConsentConfig(ConsentConfig{}) })
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("Sec-GPC", "1")
+
+		Convey("ErrRejectedByPrivacySignal is returned", func() {
+			rec := httptest.NewRecorder()
+			err := TrySetABTestCookieAspect(rec, req, testAspectID, testDomain, ABTestCookieAspect{})
+			So(errors.Is(err, ErrRejectedByPrivacySignal), ShouldBeTrue)
+			So(rec.Result().Cookies(), ShouldBeEmpty)
+		})
+	})
+}
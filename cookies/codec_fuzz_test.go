@@ -0,0 +1,191 @@
+package cookies
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const fuzzDomain = "www.test.com"
+
+// cookie times are written to the second, between the years 0 and 9999
+var (
+	minCookieTime = time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	maxCookieTime = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC).Unix()
+)
+
+// browserRequest returns a request carrying the cookies written to rec, with their values exactly as a browser would
+// send them back
+func browserRequest(rec *httptest.ResponseRecorder) *http.Request {
+	var pairs []string
+	for _, header := range rec.Header().Values("Set-Cookie") {
+		pair, _, _ := strings.Cut(header, ";")
+		pairs = append(pairs, pair)
+	}
+
+	req := httptest.NewRequest("GET", "/", http.NoBody)
+	if len(pairs) > 0 {
+		req.Header.Set("Cookie", strings.Join(pairs, "; "))
+	}
+	return req
+}
+
+// cookieSet fails the test unless err is nil, or ErrCookieTooLarge for a value which could make the cookie larger than
+// MaxCookieSize once encoded, and reports whether the cookie was set. Half of MaxCookieSize is left for the name and
+// attributes.
+func cookieSet(t *testing.T, encoded string, err error) bool {
+	t.Helper()
+	switch {
+	case errors.Is(err, ErrCookieTooLarge) && len(encoded) > MaxCookieSize/2:
+		return false
+	case err != nil:
+		t.Fatalf("setting a cookie with a %d byte value: %v", len(encoded), err)
+	case len(encoded) > MaxCookieSize:
+		t.Fatalf("a cookie with a %d byte value was set", len(encoded))
+	}
+	return true
+}
+
+// fuzzCookieTime maps any number of seconds to a time which can be written in a cookie
+func fuzzCookieTime(seconds int64) CookieTime {
+	if seconds < minCookieTime || seconds > maxCookieTime {
+		seconds = minCookieTime + (seconds%(maxCookieTime-minCookieTime)+(maxCookieTime-minCookieTime))%(maxCookieTime-minCookieTime)
+	}
+	return CookieTime{Time: time.Unix(seconds, 0).UTC()}
+}
+
+func FuzzLangRoundTrip(f *testing.F) {
+	f.Add(strings.Repeat("%", MaxCookieSize))
+	f.Fuzz(func(t *testing.T, lang string) {
+		rec := httptest.NewRecorder()
+		if !cookieSet(t, url.QueryEscape(lang), TrySetLang(rec, lang, fuzzDomain)) {
+			return
+		}
+
+		got, err := GetLang(browserRequest(rec))
+		if err != nil || got != lang {
+			t.Fatalf("GetLang(TrySetLang(%q)) = %q, %v", lang, got, err)
+		}
+	})
+}
+
+func FuzzCollectionRoundTrip(f *testing.F) {
+	f.Add(strings.Repeat("%", MaxCookieSize))
+	f.Fuzz(func(t *testing.T, collection string) {
+		rec := httptest.NewRecorder()
+		if !cookieSet(t, url.QueryEscape(collection), TrySetCollection(rec, collection, fuzzDomain)) {
+			return
+		}
+
+		got, err := GetCollection(browserRequest(rec))
+		if err != nil || got != collection {
+			t.Fatalf("GetCollection(TrySetCollection(%q)) = %q, %v", collection, got, err)
+		}
+	})
+}
+
+func FuzzTokensRoundTrip(f *testing.F) {
+	f.Add(strings.Repeat("%", MaxCookieSize))
+	f.Fuzz(func(t *testing.T, token string) {
+		for name, roundTrip := range map[string]func(w http.ResponseWriter) (func(*http.Request) (string, error), error){
+			"access_token": func(w http.ResponseWriter) (func(*http.Request) (string, error), error) {
+				return GetUserAuthToken, TrySetUserAuthToken(w, token, fuzzDomain)
+			},
+			"__Host-access_token": func(w http.ResponseWriter) (func(*http.Request) (string, error), error) {
+				return GetUserAuthToken, TrySetUserAuthTokenWithPrefix(w, token, fuzzDomain, HostPrefix, SessionExpiry)
+			},
+			"id_token": func(w http.ResponseWriter) (func(*http.Request) (string, error), error) {
+				return GetIDToken, TrySetIDToken(w, token, fuzzDomain)
+			},
+			"refresh_token": func(w http.ResponseWriter) (func(*http.Request) (string, error), error) {
+				return GetRefreshToken, TrySetRefreshToken(w, token, fuzzDomain)
+			},
+			"__Secure-refresh_token": func(w http.ResponseWriter) (func(*http.Request) (string, error), error) {
+				return GetRefreshToken, TrySetRefreshTokenWithPrefix(w, token, fuzzDomain, SecurePrefix)
+			},
+		} {
+			rec := httptest.NewRecorder()
+			getToken, err := roundTrip(rec)
+			if !cookieSet(t, url.QueryEscape(token), err) {
+				continue
+			}
+
+			got, err := getToken(browserRequest(rec))
+			if err != nil || got != token {
+				t.Fatalf("%s round trip of %q = %q, %v", name, token, got, err)
+			}
+		}
+	})
+}
+
+func FuzzONSPolicyRoundTrip(f *testing.F) {
+	f.Fuzz(func(t *testing.T, essential, settings, usage, campaigns bool, version int, consentedAt int64, consentID string) {
+		policy := ONSPolicy{
+			Essential:   essential,
+			Settings:    settings,
+			Usage:       usage,
+			Campaigns:   campaigns,
+			Version:     version,
+			ConsentedAt: fuzzCookieTime(consentedAt),
+			ConsentID:   consentID,
+		}
+
+		rec := httptest.NewRecorder()
+		err := TrySetONSPolicy(rec, policy, fuzzDomain)
+
+		// consent IDs which cannot be written in the cookie are rejected
+		if strings.ContainsFunc(consentID, func(r rune) bool { return !isCookieValueChar(r) || r == '\'' }) {
+			if !errors.Is(err, ErrInvalidConsentID) {
+				t.Fatalf("consent ID %q was not rejected: %v", consentID, err)
+			}
+			return
+		}
+		if !cookieSet(t, consentID, err) {
+			return
+		}
+
+		got, diagnostic := GetONSPolicy(browserRequest(rec))
+		if diagnostic.Status != ONSPolicyValid {
+			t.Fatalf("%+v was read back as %s: %v", policy, diagnostic.Status, diagnostic.Err())
+		}
+		if !got.ConsentedAt.Equal(policy.ConsentedAt.Time) {
+			t.Fatalf("consent time %v was read back as %v", policy.ConsentedAt, got.ConsentedAt)
+		}
+		got.ConsentedAt, policy.ConsentedAt = CookieTime{}, CookieTime{}
+		if !reflect.DeepEqual(got, policy) {
+			t.Fatalf("GetONSPolicy(TrySetONSPolicy(%+v)) = %+v", policy, got)
+		}
+	})
+}
+
+func FuzzABTestRoundTrip(f *testing.F) {
+	f.Fuzz(func(t *testing.T, aspectID string, newTime, oldTime int64) {
+		if !utf8.ValidString(aspectID) {
+			t.Skip("aspect IDs are JSON strings, which must be valid UTF-8")
+		}
+		aspect := ABTestCookieAspect{New: fuzzCookieTime(newTime), Old: fuzzCookieTime(oldTime)}
+
+		quoted, _ := json.Marshal(aspectID)
+		rec := httptest.NewRecorder()
+		err := TrySetABTestCookieAspect(rec, httptest.NewRequest("GET", "/", http.NoBody), aspectID, fuzzDomain, aspect)
+		if !cookieSet(t, url.QueryEscape(string(quoted)), err) {
+			return
+		}
+
+		aspects, err := GetABTestCookieAspects(browserRequest(rec))
+		if err != nil {
+			t.Fatalf("aspect %q was not read back: %v", aspectID, err)
+		}
+		got, ok := aspects[aspectID]
+		if !ok || len(aspects) != 1 || !got.New.Equal(aspect.New.Time) || !got.Old.Equal(aspect.Old.Time) {
+			t.Fatalf("GetABTestCookieAspects(TrySetABTestCookieAspect(%q, %+v)) = %+v", aspectID, aspect, aspects)
+		}
+	})
+}
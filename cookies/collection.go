@@ -1,14 +1,20 @@
 package cookies
 
 import (
+	"context"
 	"net/http"
 )
 
 // SetCollection sets a cookie containing collection ID
 func SetCollection(w http.ResponseWriter, value, domain string) {
+	logSetError(context.Background(), collectionIDCookieKey, TrySetCollection(w, value, domain))
+}
+
+// TrySetCollection sets a cookie containing collection ID, returning an error if the cookie cannot be set
+func TrySetCollection(w http.ResponseWriter, value, domain string) error {
 	path := "/"
 	httpOnly := false
-	set(w, collectionIDCookieKey, value, domain, path, maxAgeBrowserSession, http.SameSiteLaxMode, httpOnly)
+	return trySet(w, collectionIDCookieKey, value, domain, path, maxAgeBrowserSession, http.SameSiteLaxMode, httpOnly)
 }
 
 // GetCollection reads collection_id cookie and returns it's value
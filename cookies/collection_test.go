@@ -1,8 +1,10 @@
 package cookies
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -39,3 +41,15 @@ func TestUnitCollection(t *testing.T) {
 		So(cookie.SameSite, ShouldEqual, http.SameSiteLaxMode)
 	})
 }
+
+func TestTrySetCollection(t *testing.T) {
+	Convey("Given a collection ID too large for a cookie", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetCollection(rec, strings.Repeat("a", MaxCookieSize), "www.ons.gov.uk")
+
+		Convey("An error is returned and no cookie is set", func() {
+			So(errors.Is(err, ErrCookieTooLarge), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package cookies
+
+import (
+	"sync"
+	"time"
+)
+
+// ConsentConfig determines when consent recorded in the ons_cookie_policy cookie is no longer valid
+type ConsentConfig struct {
+	// CurrentVersion is the version of the cookie policy users are asked to consent to. Consent given to an earlier
+	// version must be given again. Versioning is disabled when zero.
+	CurrentVersion int
+	// MaxAge is how long consent remains valid after it was given. Consent never expires when zero.
+	MaxAge time.Duration
+	// HonourGPC treats a 'Sec-GPC: 1' header as rejecting non-essential cookies when the user has not made a choice
+	HonourGPC bool
+	// HonourDNT treats a 'DNT: 1' header as rejecting non-essential cookies when the user has not made a choice
+	HonourDNT bool
+}
+
+var (
+	consentConfigMutex sync.RWMutex
+	consentConfig      ConsentConfig
+)
+
+// SetConsentConfig sets the consent configuration used by SetONSPolicy and GetONSCookiePreferences. It is intended to
+// be called once when a service starts.
+func SetConsentConfig(cfg ConsentConfig) {
+	consentConfigMutex.Lock()
+	defer consentConfigMutex.Unlock()
+	consentConfig = cfg
+}
+
+func getConsentConfig() ConsentConfig {
+	consentConfigMutex.RLock()
+	defer consentConfigMutex.RUnlock()
+	return consentConfig
+}
+
+// NeedsReconsent reports whether the consent in the policy was given to an outdated version of the cookie policy, or
+// has expired, at the given time
+func (cfg ConsentConfig) NeedsReconsent(policy ONSPolicy, now time.Time) bool {
+	if cfg.CurrentVersion > 0 && policy.Version < cfg.CurrentVersion {
+		return true
+	}
+
+	if cfg.MaxAge > 0 {
+		return policy.ConsentedAt.IsZero() || policy.ConsentedAt.Add(cfg.MaxAge).Before(now)
+	}
+
+	return false
+}
+
+// stamp records the current version and consent time on a policy being written, replacing any it already carries, as
+// writing the policy is the user consenting to the current version now
+func (cfg ConsentConfig) stamp(policy ONSPolicy, now CookieTime) ONSPolicy {
+	if cfg.CurrentVersion == 0 && cfg.MaxAge == 0 {
+		return policy
+	}
+
+	policy.Version = cfg.CurrentVersion
+	policy.ConsentedAt = now
+
+	return policy
+}
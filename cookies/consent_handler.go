@@ -0,0 +1,204 @@
+package cookies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ConsentActionAcceptAll consents to every category
+	ConsentActionAcceptAll = "accept-all"
+
+	// ConsentActionRejectAll consents to essential cookies only
+	ConsentActionRejectAll = "reject-all"
+
+	// ConsentActionSave consents to the categories given in the request
+	ConsentActionSave = "save"
+
+	// maxConsentBodySize is the largest consent request body which is read
+	maxConsentBodySize = 1 << 16
+)
+
+// DefaultCategoryCookies are the cookies expired when consent to a category is withdrawn. A trailing '*' matches any
+// cookie name with that prefix.
+var DefaultCategoryCookies = map[string][]string{
+	CategoryUsage: {"_ga", "_ga_*", "_gid", "_gat", "_gat_*"},
+}
+
+// ConsentHandler processes the 'accept all', 'reject all' and 'save preferences' posts of the cookie banner and
+// cookie settings page, so that users without JavaScript get the same behaviour on every site.
+//
+// Requests are form posts, or JSON, with an 'action' of accept-all, reject-all or save. The save action takes a true
+// or false value for each of the 'settings', 'usage' and 'campaigns' categories; essential cookies are always
+// allowed. Form posts are redirected to a same-origin 'return_to' parameter or Referer, and JSON requests receive the
+// policy written, including its version, consent time and consent ID. When the consent cookies cannot be set, or the
+// ConsentRecorder fails, no cookies are set and a 500 Internal Server Error is returned.
+type ConsentHandler struct {
+	// Domain is the domain of the consent cookies
+	Domain string
+	// CategoryCookies are the cookies expired when consent to a category is withdrawn
+	CategoryCookies map[string][]string
+	// DefaultReturnTo is where form posts are redirected when there is no valid return_to parameter or Referer
+	DefaultReturnTo string
+}
+
+// NewConsentHandler returns a ConsentHandler for the domain which expires the DefaultCategoryCookies
+func NewConsentHandler(domain string) *ConsentHandler {
+	return &ConsentHandler{
+		Domain:          domain,
+		CategoryCookies: DefaultCategoryCookies,
+		DefaultReturnTo: "/",
+	}
+}
+
+// consentRequest is the body of a consent request
+type consentRequest struct {
+	Action    string `json:"action"`
+	Settings  *bool  `json:"settings"`
+	Usage     *bool  `json:"usage"`
+	Campaigns *bool  `json:"campaigns"`
+	ReturnTo  string `json:"return_to"`
+}
+
+func (h *ConsentHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	isJSON := isJSONRequest(req)
+	body, err := parseConsentRequest(w, req, isJSON)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy, err := body.policy()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the cookies are only sent once the consent has been recorded, so a user is never told their consent was saved
+	// when it was not
+	oldPolicy := getONSPolicy(req)
+	buffer := headerWriter{header: http.Header{}}
+	written, err := trySetONSConsent(buffer, req, policy, h.Domain)
+	if err != nil {
+		getLogger().Error(req.Context(), "error setting consent", err, nil)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	for _, value := range buffer.header.Values("Set-Cookie") {
+		w.Header().Add("Set-Cookie", value)
+	}
+	h.purgeWithdrawn(w, req, oldPolicy, written)
+
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(written)
+		return
+	}
+
+	fallback := h.DefaultReturnTo
+	if fallback == "" {
+		fallback = "/"
+	}
+	http.Redirect(w, req, safeReturnTo(req, body.ReturnTo, fallback), http.StatusSeeOther)
+}
+
+// purgeWithdrawn expires the cookies of every category the user previously consented to, but no longer does
+func (h *ConsentHandler) purgeWithdrawn(w http.ResponseWriter, req *http.Request, oldPolicy, newPolicy ONSPolicy) {
+	for name, field := range onsPolicyFields {
+		if !*field(&oldPolicy) || *field(&newPolicy) {
+			continue
+		}
+
+		for _, pattern := range h.CategoryCookies[name] {
+			for _, c := range req.Cookies() {
+				if matchesCookiePattern(c.Name, pattern) {
+					expire(w, c.Name, h.Domain, "/")
+				}
+			}
+		}
+	}
+}
+
+// policy returns the policy for the requested action
+func (r consentRequest) policy() (ONSPolicy, error) {
+	switch r.Action {
+	case ConsentActionAcceptAll:
+		return ONSPolicy{Essential: true, Settings: true, Usage: true, Campaigns: true}, nil
+	case ConsentActionRejectAll:
+		return ONSPolicy{Essential: true}, nil
+	case ConsentActionSave:
+		if r.Settings == nil || r.Usage == nil || r.Campaigns == nil {
+			return ONSPolicy{}, errors.New("settings, usage and campaigns are required to save preferences")
+		}
+		return ONSPolicy{Essential: true, Settings: *r.Settings, Usage: *r.Usage, Campaigns: *r.Campaigns}, nil
+	default:
+		return ONSPolicy{}, fmt.Errorf("invalid action %q", r.Action)
+	}
+}
+
+func parseConsentRequest(w http.ResponseWriter, req *http.Request, isJSON bool) (consentRequest, error) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxConsentBodySize)
+
+	var body consentRequest
+	if isJSON {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return consentRequest{}, fmt.Errorf("invalid consent request: %w", err)
+		}
+		return body, nil
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return consentRequest{}, fmt.Errorf("invalid consent request: %w", err)
+	}
+
+	body.Action = req.PostForm.Get("action")
+	body.ReturnTo = req.Form.Get("return_to")
+	for name, field := range map[string]**bool{CategorySettings: &body.Settings, CategoryUsage: &body.Usage, CategoryCampaigns: &body.Campaigns} {
+		if _, ok := req.PostForm[name]; !ok {
+			continue
+		}
+
+		value, err := parseFormBool(req.PostForm.Get(name))
+		if err != nil {
+			return consentRequest{}, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		*field = &value
+	}
+
+	return body, nil
+}
+
+// parseFormBool parses the values used by radio buttons and checkboxes on the cookie settings page
+func parseFormBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "on", "yes":
+		return true, nil
+	case "false", "off", "no":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%q is not true or false", value)
+	}
+}
+
+func isJSONRequest(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// matchesCookiePattern reports whether name is pattern, or starts with pattern when it ends in '*'
+func matchesCookiePattern(name, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return name == pattern
+}
@@ -0,0 +1,184 @@
+package cookies
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newConsentFormRequest(form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "http://www.ons.gov.uk/cookies", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func writtenCookies(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+	written := map[string]*http.Cookie{}
+	for _, c := range rec.Result().Cookies() {
+		written[c.Name] = c
+	}
+	return written
+}
+
+func TestConsentHandler(t *testing.T) {
+	Convey("Given a consent handler", t, func() {
+		handler := NewConsentHandler(testDomain)
+
+		Convey("When a user accepts all cookies", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newConsentFormRequest(url.Values{"action": {"accept-all"}, "return_to": {"/economy?page=2"}}))
+
+			Convey("Both consent cookies are written and the user is redirected back", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 2)
+				policy, _ := ParseONSPolicy(written[onsCookiePolicyCookieKey].Value)
+				So(policy.Settings && policy.Usage && policy.Campaigns, ShouldBeTrue)
+				So(written[onsCookiePreferencesSetCookieKey].Value, ShouldEqual, "true")
+				So(rec.Code, ShouldEqual, http.StatusSeeOther)
+				So(rec.Header().Get("Location"), ShouldEqual, "/economy?page=2")
+			})
+		})
+
+		Convey("When a user rejects all cookies", func() {
+			rec := httptest.NewRecorder()
+			req := newConsentFormRequest(url.Values{"action": {"reject-all"}})
+			req.Header.Set("Referer", "http://www.ons.gov.uk/people?lang=cy")
+			handler.ServeHTTP(rec, req)
+
+			Convey("Only essential cookies are allowed and the user is redirected to the same-origin Referer", func() {
+				policy, _ := ParseONSPolicy(writtenCookies(rec)[onsCookiePolicyCookieKey].Value)
+				So(policy.Essential, ShouldBeTrue)
+				So(policy.Settings || policy.Usage || policy.Campaigns, ShouldBeFalse)
+				So(rec.Header().Get("Location"), ShouldEqual, "/people?lang=cy")
+			})
+		})
+
+		Convey("When a user saves their preferences", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newConsentFormRequest(url.Values{"action": {"save"}, "settings": {"on"}, "usage": {"off"}, "campaigns": {"true"}}))
+
+			Convey("The chosen categories are written", func() {
+				policy, _ := ParseONSPolicy(writtenCookies(rec)[onsCookiePolicyCookieKey].Value)
+				So(policy.Settings, ShouldBeTrue)
+				So(policy.Usage, ShouldBeFalse)
+				So(policy.Campaigns, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a user withdraws consent to usage cookies", func() {
+			rec := httptest.NewRecorder()
+			req := newConsentFormRequest(url.Values{"action": {"reject-all"}})
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':false,'usage':true,'campaigns':false}"})
+			req.AddCookie(&http.Cookie{Name: "_ga", Value: "GA1"})
+			req.AddCookie(&http.Cookie{Name: "_ga_ABC123", Value: "GS1"})
+			req.AddCookie(&http.Cookie{Name: "other", Value: "kept"})
+			handler.ServeHTTP(rec, req)
+
+			Convey("The usage cookies are expired", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 4)
+				So(written["_ga"].MaxAge, ShouldEqual, -1)
+				So(written["_ga_ABC123"].MaxAge, ShouldEqual, -1)
+				So(written["_ga"].Domain, ShouldEqual, testDomain)
+				So(written, ShouldNotContainKey, "other")
+			})
+		})
+
+		Convey("When the consent is sent as JSON", func() {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/cookies", strings.NewReader(`{"action":"save","settings":false,"usage":true,"campaigns":false}`))
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			handler.ServeHTTP(rec, req)
+
+			Convey("The resulting policy is returned", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				var policy ONSPolicy
+				So(json.Unmarshal(rec.Body.Bytes(), &policy), ShouldBeNil)
+				So(policy.Usage, ShouldBeTrue)
+				So(writtenCookies(rec), ShouldHaveLength, 2)
+			})
+
+			Convey("The policy returned is the policy written", func() {
+				var policy ONSPolicy
+				So(json.Unmarshal(rec.Body.Bytes(), &policy), ShouldBeNil)
+				So(policy.ConsentID, ShouldNotBeEmpty)
+				So(policy.ConsentedAt.IsZero(), ShouldBeFalse)
+				written, _ := ParseONSPolicy(writtenCookies(rec)[onsCookiePolicyCookieKey].Value)
+				So(policy.ConsentID, ShouldEqual, written.ConsentID)
+				So(policy.ConsentedAt.Unix(), ShouldEqual, written.ConsentedAt.Unix())
+			})
+		})
+
+		Convey("When the consent cookies cannot be set", func() {
+			handler.Domain = "invalid domain"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newConsentFormRequest(url.Values{"action": {"accept-all"}}))
+
+			Convey("No cookies are written and an error is returned", func() {
+				So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+				So(rec.Result().Cookies(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the consent cannot be recorded", func() {
+			SetConsentRecorder(failingConsentRecorder{})
+			Reset(func() { SetConsentRecorder(nil) })
+			rec := httptest.NewRecorder()
+			req := newConsentFormRequest(url.Values{"action": {"reject-all"}})
+			req.AddCookie(&http.Cookie{Name: "_ga", Value: "GA1.1"})
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':true,'usage':true,'campaigns':true}"})
+			handler.ServeHTTP(rec, req)
+
+			Convey("No cookies are written or expired and an error is returned", func() {
+				So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+				So(rec.Result().Cookies(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the request is invalid", func() {
+			requests := map[string]*http.Request{
+				"unknown action":     newConsentFormRequest(url.Values{"action": {"maybe"}}),
+				"missing categories": newConsentFormRequest(url.Values{"action": {"save"}, "usage": {"on"}}),
+				"invalid category":   newConsentFormRequest(url.Values{"action": {"save"}, "settings": {"on"}, "usage": {"perhaps"}, "campaigns": {"on"}}),
+			}
+			jsonReq := httptest.NewRequest(http.MethodPost, "/cookies", strings.NewReader(`{"action":`))
+			jsonReq.Header.Set("Content-Type", "application/json")
+			requests["invalid JSON"] = jsonReq
+
+			for name, req := range requests {
+				Convey("No cookies are written for "+name, func() {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, req)
+					So(rec.Code, ShouldEqual, http.StatusBadRequest)
+					So(rec.Result().Cookies(), ShouldBeEmpty)
+				})
+			}
+		})
+
+		Convey("When the request is not a POST", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cookies", http.NoBody))
+
+			Convey("It is rejected", func() {
+				So(rec.Code, ShouldEqual, http.StatusMethodNotAllowed)
+				So(rec.Header().Get("Allow"), ShouldEqual, http.MethodPost)
+			})
+		})
+
+		Convey("When the return_to and Referer are for another site", func() {
+			rec := httptest.NewRecorder()
+			req := newConsentFormRequest(url.Values{"action": {"accept-all"}, "return_to": {"//evil.example.com/"}})
+			req.Header.Set("Referer", "https://evil.example.com/phish")
+			handler.ServeHTTP(rec, req)
+
+			Convey("The user is redirected to the default location", func() {
+				So(rec.Header().Get("Location"), ShouldEqual, "/")
+			})
+		})
+	})
+}
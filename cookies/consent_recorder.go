@@ -0,0 +1,179 @@
+package cookies
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ConsentRecord is an audit record of a user giving or changing their consent
+type ConsentRecord struct {
+	ConsentID string     `json:"consent_id"`
+	OldPolicy ONSPolicy  `json:"old_policy"`
+	NewPolicy ONSPolicy  `json:"new_policy"`
+	Version   int        `json:"version"`
+	Timestamp CookieTime `json:"timestamp"`
+	UserAgent string     `json:"user_agent"`
+}
+
+// ConsentRecorder keeps an audit log of consent given by users. It is called by SetONSConsent and TrySetONSConsent,
+// which ConsentHandler uses, and by LegacyPolicyMigration. The deprecated SetONSPolicy and SetONSPreferenceIsSet do not
+// call it.
+type ConsentRecorder interface {
+	RecordConsent(ctx context.Context, record ConsentRecord) error
+}
+
+var (
+	consentRecorderMutex sync.RWMutex
+	consentRecorder      ConsentRecorder
+)
+
+// SetConsentRecorder sets the recorder called by SetONSConsent, or disables recording when nil. It is intended to be
+// called once when a service starts.
+func SetConsentRecorder(recorder ConsentRecorder) {
+	consentRecorderMutex.Lock()
+	defer consentRecorderMutex.Unlock()
+	consentRecorder = recorder
+}
+
+func getConsentRecorder() ConsentRecorder {
+	consentRecorderMutex.RLock()
+	defer consentRecorderMutex.RUnlock()
+	return consentRecorder
+}
+
+// SetONSConsent sets the ONS policy and preferences set cookies for consent given by the user, recording the current
+// policy version, the consent time and an anonymous consent ID, which is kept across subsequent changes. The change is
+// then passed to the ConsentRecorder set by SetConsentRecorder.
+func SetONSConsent(w http.ResponseWriter, req *http.Request, policy ONSPolicy, domain string) {
+	if err := TrySetONSConsent(w, req, policy, domain); err != nil {
+		getLogger().Error(req.Context(), "error setting consent", err, nil)
+	}
+}
+
+// TrySetONSConsent sets the consent cookies and records the change as SetONSConsent does, returning an error if either
+// cookie cannot be set, or the change cannot be recorded. Either both cookies are set or neither is.
+func TrySetONSConsent(w http.ResponseWriter, req *http.Request, policy ONSPolicy, domain string) error {
+	_, err := trySetONSConsent(w, req, policy, domain)
+	return err
+}
+
+// trySetONSConsent sets the consent cookies and records the change, returning the policy written
+func trySetONSConsent(w http.ResponseWriter, req *http.Request, policy ONSPolicy, domain string) (ONSPolicy, error) {
+	oldPolicy, diagnostic := GetONSPolicy(req)
+	if diagnostic.Status == ONSPolicyNotRecorded {
+		oldPolicy = ONSPolicy{}
+	}
+
+	policy.Version = getConsentConfig().CurrentVersion
+	policy.ConsentedAt = Now()
+	policy.ConsentID = oldPolicy.ConsentID
+	if policy.ConsentID == "" || !isValidConsentID(policy.ConsentID) {
+		policy.ConsentID = newConsentID()
+	}
+
+	// the cookies are written to a buffer first, so that either both or neither are set
+	buffer := headerWriter{header: http.Header{}}
+	if err := TrySetONSPolicy(buffer, policy, domain); err != nil {
+		return ONSPolicy{}, err
+	}
+	if err := TrySetONSPreferenceIsSet(buffer, domain); err != nil {
+		return ONSPolicy{}, err
+	}
+	for _, value := range buffer.header.Values("Set-Cookie") {
+		w.Header().Add("Set-Cookie", value)
+	}
+	recordConsentChoices(policy)
+
+	return policy, recordConsent(req, oldPolicy, policy, policy.ConsentedAt)
+}
+
+// recordConsent passes a change of the user's consent to the ConsentRecorder set by SetConsentRecorder, if any
+func recordConsent(req *http.Request, oldPolicy, newPolicy ONSPolicy, at CookieTime) error {
+	recorder := getConsentRecorder()
+	if recorder == nil {
+		return nil
+	}
+
+	record := ConsentRecord{
+		ConsentID: newPolicy.ConsentID,
+		OldPolicy: oldPolicy,
+		NewPolicy: newPolicy,
+		Version:   newPolicy.Version,
+		Timestamp: at,
+		UserAgent: req.UserAgent(),
+	}
+	if err := recorder.RecordConsent(req.Context(), record); err != nil {
+		return fmt.Errorf("error recording consent %s: %w", record.ConsentID, err)
+	}
+	return nil
+}
+
+// newConsentID returns a random identifier which cannot be linked to the user
+func newConsentID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// FileConsentRecorder is a ConsentRecorder which appends each record to a file as a line of JSON
+type FileConsentRecorder struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileConsentRecorder opens, or creates, the file at path for appending consent records
+func NewFileConsentRecorder(path string) (*FileConsentRecorder, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gosec // path is configured by the service
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileConsentRecorder{file: file}, nil
+}
+
+// RecordConsent appends the record to the file
+func (r *FileConsentRecorder) RecordConsent(_ context.Context, record ConsentRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, err = r.file.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the file
+func (r *FileConsentRecorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.file.Close()
+}
+
+// MemoryConsentRecorder is a ConsentRecorder which keeps records in memory, for use in tests
+type MemoryConsentRecorder struct {
+	mutex   sync.Mutex
+	records []ConsentRecord
+}
+
+// RecordConsent keeps the record
+func (r *MemoryConsentRecorder) RecordConsent(_ context.Context, record ConsentRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.records = append(r.records, record)
+	return nil
+}
+
+// Records returns a copy of every record kept, in the order they were recorded
+func (r *MemoryConsentRecorder) Records() []ConsentRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]ConsentRecord(nil), r.records...)
+}
@@ -0,0 +1,177 @@
+package cookies
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failingConsentRecorder struct{}
+
+func (failingConsentRecorder) RecordConsent(context.Context, ConsentRecord) error {
+	return errors.New("recorder unavailable")
+}
+
+func TestSetONSConsent(t *testing.T) {
+	Convey("Given a consent recorder and policy version", t, func() {
+		recorder := &MemoryConsentRecorder{}
+		SetConsentRecorder(recorder)
+		SetConsentConfig(ConsentConfig{CurrentVersion: 4})
+		Reset(func() {
+			SetConsentRecorder(nil)
+			SetConsentConfig(ConsentConfig{})
+		})
+
+		Convey("When a user without recorded consent gives consent", func() {
+			req := httptest.NewRequest("POST", "/cookies", http.NoBody)
+			req.Header.Set("User-Agent", "test-agent")
+			rec := httptest.NewRecorder()
+			SetONSConsent(rec, req, ONSPolicy{Essential: true, Usage: true}, testDomain)
+
+			Convey("The policy and preferences set cookies are written", func() {
+				cookies := rec.Result().Cookies()
+				So(cookies, ShouldHaveLength, 2)
+				So(cookies[1].Name, ShouldEqual, onsCookiePreferencesSetCookieKey)
+
+				policy, diagnostic := ParseONSPolicy(cookies[0].Value)
+				So(diagnostic.Status, ShouldEqual, ONSPolicyValid)
+				So(policy.Usage, ShouldBeTrue)
+				So(policy.Version, ShouldEqual, 4)
+				So(policy.ConsentID, ShouldHaveLength, 32)
+				So(policy.ConsentedAt.IsZero(), ShouldBeFalse)
+			})
+
+			Convey("The consent is recorded", func() {
+				records := recorder.Records()
+				So(records, ShouldHaveLength, 1)
+				So(records[0].OldPolicy, ShouldResemble, ONSPolicy{})
+				So(records[0].NewPolicy.Usage, ShouldBeTrue)
+				So(records[0].Version, ShouldEqual, 4)
+				So(records[0].UserAgent, ShouldEqual, "test-agent")
+				So(records[0].ConsentID, ShouldEqual, records[0].NewPolicy.ConsentID)
+				So(records[0].Timestamp, ShouldResemble, records[0].NewPolicy.ConsentedAt)
+			})
+
+			Convey("And the user later changes their consent", func() {
+				next := httptest.NewRequest("POST", "/cookies", http.NoBody)
+				next.AddCookie(rec.Result().Cookies()[0])
+				SetONSConsent(httptest.NewRecorder(), next, ONSPolicy{Essential: true, Campaigns: true}, testDomain)
+
+				Convey("The change is recorded against the same consent ID", func() {
+					records := recorder.Records()
+					So(records, ShouldHaveLength, 2)
+					So(records[1].ConsentID, ShouldEqual, records[0].ConsentID)
+					So(records[1].OldPolicy.Usage, ShouldBeTrue)
+					So(records[1].NewPolicy.Campaigns, ShouldBeTrue)
+					So(records[1].NewPolicy.Usage, ShouldBeFalse)
+				})
+			})
+		})
+
+		Convey("When a user whose cookie has a consent ID which cannot be written again gives consent", func() {
+			req := httptest.NewRequest("POST", "/cookies", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: url.QueryEscape(`{"essential":true,"settings":false,"usage":false,"campaigns":false,"consent_id":"a b"}`)})
+			rec := httptest.NewRecorder()
+
+			Convey("The consent is written with a new consent ID", func() {
+				So(TrySetONSConsent(rec, req, ONSPolicy{Essential: true}, testDomain), ShouldBeNil)
+				records := recorder.Records()
+				So(records[0].OldPolicy.ConsentID, ShouldEqual, "a b")
+				So(records[0].ConsentID, ShouldHaveLength, 32)
+			})
+		})
+	})
+
+	Convey("Given a consent recorder which fails", t, func() {
+		SetConsentRecorder(failingConsentRecorder{})
+		Reset(func() { SetConsentRecorder(nil) })
+
+		Convey("The cookies are still written", func() {
+			rec := httptest.NewRecorder()
+			SetONSConsent(rec, httptest.NewRequest("POST", "/", http.NoBody), ONSPolicy{Essential: true}, testDomain)
+			So(rec.Result().Cookies(), ShouldHaveLength, 2)
+		})
+	})
+
+	Convey("Given no consent recorder", t, func() {
+		Convey("The cookies are written", func() {
+			rec := httptest.NewRecorder()
+			SetONSConsent(rec, httptest.NewRequest("POST", "/", http.NoBody), ONSPolicy{Essential: true}, testDomain)
+			So(rec.Result().Cookies(), ShouldHaveLength, 2)
+		})
+	})
+}
+
+func TestFileConsentRecorder(t *testing.T) {
+	Convey("Given a file consent recorder", t, func() {
+		path := filepath.Join(t.TempDir(), "consent.jsonl")
+		recorder, err := NewFileConsentRecorder(path)
+		So(err, ShouldBeNil)
+
+		Convey("Each record is appended to the file as a line of JSON", func() {
+			first := ConsentRecord{ConsentID: "first", NewPolicy: ONSPolicy{Essential: true}, Timestamp: MustParseCookieTime("2021-01-01T15:31:23")}
+			second := ConsentRecord{ConsentID: "second", Version: 2, UserAgent: "agent", Timestamp: MustParseCookieTime("2021-01-02T15:31:23")}
+			So(recorder.RecordConsent(context.Background(), first), ShouldBeNil)
+			So(recorder.RecordConsent(context.Background(), second), ShouldBeNil)
+			So(recorder.Close(), ShouldBeNil)
+
+			f, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer f.Close()
+
+			var records []ConsentRecord
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var r ConsentRecord
+				So(json.Unmarshal(scanner.Bytes(), &r), ShouldBeNil)
+				records = append(records, r)
+			}
+			So(records, ShouldResemble, []ConsentRecord{first, second})
+		})
+	})
+
+	Convey("Given a path which cannot be opened", t, func() {
+		_, err := NewFileConsentRecorder(filepath.Join(t.TempDir(), "missing", "consent.jsonl"))
+
+		Convey("An error is returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTrySetONSConsent(t *testing.T) {
+	Convey("Given a consent recorder which fails", t, func() {
+		SetConsentRecorder(failingConsentRecorder{})
+		Reset(func() { SetConsentRecorder(nil) })
+
+		Convey("The cookies are written and the recorder error is returned", func() {
+			rec := httptest.NewRecorder()
+			err := TrySetONSConsent(rec, httptest.NewRequest("POST", "/", http.NoBody), ONSPolicy{Essential: true}, testDomain)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "recorder unavailable")
+			So(rec.Result().Cookies(), ShouldHaveLength, 2)
+		})
+	})
+
+	Convey("Given an invalid domain", t, func() {
+		recorder := &MemoryConsentRecorder{}
+		SetConsentRecorder(recorder)
+		Reset(func() { SetConsentRecorder(nil) })
+
+		Convey("An error is returned and the consent is not recorded", func() {
+			rec := httptest.NewRecorder()
+			err := TrySetONSConsent(rec, httptest.NewRequest("POST", "/", http.NoBody), ONSPolicy{Essential: true}, "a..b")
+			So(errors.Is(err, ErrInvalidCookieDomain), ShouldBeTrue)
+			So(recorder.Records(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConsentConfigNeedsReconsent(t *testing.T) {
+	now := MustParseCookieTime("2021-06-01T12:00:00").Time
+	policy := ONSPolicy{Essential: true, Version: 2, ConsentedAt: MustParseCookieTime("2021-01-01T12:00:00")}
+
+	Convey("Given no consent configuration", t, func() {
+		cfg := ConsentConfig{}
+
+		Convey("Consent never needs to be given again", func() {
+			So(cfg.NeedsReconsent(policy, now), ShouldBeFalse)
+			So(cfg.NeedsReconsent(ONSPolicy{}, now), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a current policy version", t, func() {
+		Convey("Consent to the current version is valid", func() {
+			So(ConsentConfig{CurrentVersion: 2}.NeedsReconsent(policy, now), ShouldBeFalse)
+		})
+
+		Convey("Consent to an earlier version must be given again", func() {
+			So(ConsentConfig{CurrentVersion: 3}.NeedsReconsent(policy, now), ShouldBeTrue)
+		})
+
+		Convey("Consent without a version must be given again", func() {
+			So(ConsentConfig{CurrentVersion: 1}.NeedsReconsent(ONSPolicy{}, now), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a maximum consent age", t, func() {
+		Convey("Consent given within the maximum age is valid", func() {
+			So(ConsentConfig{MaxAge: time.Hour * 24 * 365}.NeedsReconsent(policy, now), ShouldBeFalse)
+		})
+
+		Convey("Consent given before the maximum age must be given again", func() {
+			So(ConsentConfig{MaxAge: time.Hour * 24 * 30}.NeedsReconsent(policy, now), ShouldBeTrue)
+		})
+
+		Convey("Consent without a consent time must be given again", func() {
+			So(ConsentConfig{MaxAge: time.Hour}.NeedsReconsent(ONSPolicy{}, now), ShouldBeTrue)
+		})
+	})
+}
+
+func TestConsentVersioning(t *testing.T) {
+	Convey("Given consent versioning is configured", t, func() {
+		SetConsentConfig(ConsentConfig{CurrentVersion: 2, MaxAge: time.Hour})
+		Reset(func() { SetConsentConfig(ConsentConfig{}) })
+
+		Convey("SetONSPolicy records the current version and consent time", func() {
+			rec := httptest.NewRecorder()
+			SetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true}, testDomain)
+			policy, diagnostic := ParseONSPolicy(rec.Result().Cookies()[0].Value)
+			So(diagnostic.Status, ShouldEqual, ONSPolicyValid)
+			So(policy.Version, ShouldEqual, 2)
+			So(time.Since(policy.ConsentedAt.Time), ShouldBeLessThan, time.Minute)
+
+			Convey("And GetONSCookiePreferences reports the preferences as set", func() {
+				req := httptest.NewRequest("GET", "/", http.NoBody)
+				req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: rec.Result().Cookies()[0].Value})
+				req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+				preferences := GetONSCookiePreferences(req)
+				So(preferences.IsPreferenceSet, ShouldBeTrue)
+				So(preferences.NeedsReconsent, ShouldBeFalse)
+			})
+		})
+
+		Convey("SetONSPolicy replaces an outdated version and consent time already on the policy", func() {
+			rec := httptest.NewRecorder()
+			SetONSPolicy(rec, ONSPolicy{Essential: true, Version: 1, ConsentedAt: MustParseCookieTime("2021-01-01T15:31:23")}, testDomain)
+			policy, diagnostic := ParseONSPolicy(rec.Result().Cookies()[0].Value)
+			So(diagnostic.Status, ShouldEqual, ONSPolicyValid)
+			So(policy.Version, ShouldEqual, 2)
+			So(time.Since(policy.ConsentedAt.Time), ShouldBeLessThan, time.Minute)
+		})
+
+		Convey("GetONSCookiePreferences reports consent to an earlier version as needing reconsent", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':false,'usage':true,'campaigns':false,'version':1,'consented_at':'" + Now().String() + "'}"})
+			req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+			preferences := GetONSCookiePreferences(req)
+			So(preferences.IsPreferenceSet, ShouldBeFalse)
+			So(preferences.NeedsReconsent, ShouldBeTrue)
+			So(preferences.Policy.Usage, ShouldBeTrue)
+		})
+
+		Convey("GetONSCookiePreferences reports expired consent as needing reconsent", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':false,'usage':true,'campaigns':false,'version':2,'consented_at':'2021-01-01T15:31:23'}"})
+			req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+			preferences := GetONSCookiePreferences(req)
+			So(preferences.IsPreferenceSet, ShouldBeFalse)
+			So(preferences.NeedsReconsent, ShouldBeTrue)
+		})
+
+		Convey("GetONSCookiePreferences does not report reconsent when no preference has been set", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			preferences := GetONSCookiePreferences(req)
+			So(preferences.IsPreferenceSet, ShouldBeFalse)
+			So(preferences.NeedsReconsent, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given consent versioning is not configured", t, func() {
+		Convey("SetONSPolicy writes only the consent categories", func() {
+			rec := httptest.NewRecorder()
+			SetONSPolicy(rec, ONSPolicy{Essential: true}, testDomain)
+			So(rec.Result().Cookies()[0].Value, ShouldEqual, "{'essential':true,'settings':false,'usage':false,'campaigns':false}")
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package cookies
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookieValidation is middleware which checks the Set-Cookie headers of each response before they are sent. Cookies
+// which ValidateCookieForRequest rejects for the request, e.g. for a domain not matching the request host, and cookies
+// which would take the headers over Budget, are dropped with the error logged.
+type CookieValidation struct {
+	// Budget is the largest combined size of a response's Set-Cookie headers, as checked by CheckResponseCookieBudget.
+	// The budget is not checked when zero.
+	Budget int
+}
+
+// NewCookieValidation returns a CookieValidation with DefaultResponseCookieBudget
+func NewCookieValidation() *CookieValidation {
+	return &CookieValidation{Budget: DefaultResponseCookieBudget}
+}
+
+// Middleware calls next with a response writer which checks the Set-Cookie headers when the response is written
+func (v *CookieValidation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		vw := &validatingWriter{ResponseWriter: w, req: req, budget: v.Budget}
+		next.ServeHTTP(vw, req)
+		// a handler which writes nothing has its headers sent once it returns
+		vw.check()
+	})
+}
+
+// validatingWriter is a http.ResponseWriter which checks the Set-Cookie headers before they are sent
+type validatingWriter struct {
+	http.ResponseWriter
+	req     *http.Request
+	budget  int
+	checked bool
+}
+
+func (w *validatingWriter) WriteHeader(code int) {
+	w.check()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *validatingWriter) Write(b []byte) (int, error) {
+	w.check()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *validatingWriter) Flush() {
+	w.check()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *validatingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// check drops the Set-Cookie headers which are invalid for the request, then those which would exceed the budget, in
+// the order they were written
+func (w *validatingWriter) check() {
+	if w.checked {
+		return
+	}
+	w.checked = true
+
+	header := w.Header()
+	values := header.Values("Set-Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	kept := make([]string, 0, len(values))
+	for _, value := range values {
+		name, _, _ := strings.Cut(value, "=")
+
+		c, err := http.ParseSetCookie(value)
+		if err == nil {
+			err = ValidateCookieForRequest(w.req, c)
+		}
+		if err == nil && w.budget > 0 {
+			err = CheckResponseCookieBudget(http.Header{"Set-Cookie": append(kept[:len(kept):len(kept)], value)}, w.budget)
+		}
+		if err != nil {
+			logSetError(w.req.Context(), strings.TrimSpace(name), err)
+			continue
+		}
+		kept = append(kept, value)
+	}
+
+	header.Del("Set-Cookie")
+	for _, value := range kept {
+		header.Add("Set-Cookie", value)
+	}
+}
@@ -0,0 +1,90 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCookieValidation(t *testing.T) {
+	Convey("Given the cookie validation middleware", t, func() {
+		l := &testLogger{}
+		SetLogger(l)
+		Reset(func() { SetLogger(nil) })
+
+		validation := NewCookieValidation()
+		serve := func(req *http.Request, handler http.HandlerFunc) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			validation.Middleware(handler).ServeHTTP(rec, req)
+			return rec
+		}
+
+		Convey("When a handler sets cookies for the request host and a parent domain", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "https://www.ons.gov.uk/", http.NoBody), func(w http.ResponseWriter, _ *http.Request) {
+				SetLang(w, "cy", "www.ons.gov.uk")
+				SetCollection(w, "collection", "ons.gov.uk")
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			Convey("Both cookies are sent", func() {
+				So(rec.Code, ShouldEqual, http.StatusCreated)
+				So(rec.Result().Cookies(), ShouldHaveLength, 2)
+				So(l.events, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a handler sets a cookie for another domain", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "https://www.ons.gov.uk/", http.NoBody), func(w http.ResponseWriter, _ *http.Request) {
+				SetLang(w, "cy", "cy.ons.gov.uk")
+				SetCollection(w, "collection", "www.ons.gov.uk")
+				_, _ = w.Write([]byte("body"))
+			})
+
+			Convey("The cookie is dropped and the error logged", func() {
+				cookies := rec.Result().Cookies()
+				So(cookies, ShouldHaveLength, 1)
+				So(cookies[0].Name, ShouldEqual, collectionIDCookieKey)
+				So(l.events, ShouldHaveLength, 1)
+				So(errors.Is(l.events[0].Err, ErrInvalidCookieDomain), ShouldBeTrue)
+				So(l.events[0].Data, ShouldResemble, map[string]interface{}{"name": localeCookieKey})
+			})
+		})
+
+		Convey("When a handler which writes nothing sets cookies over the budget", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "https://www.ons.gov.uk/", http.NoBody), func(w http.ResponseWriter, _ *http.Request) {
+				for _, name := range []string{"a", "b", "c"} {
+					SetCollection(w, strings.Repeat(name, 3000), "www.ons.gov.uk")
+				}
+				SetLang(w, "cy", "www.ons.gov.uk")
+			})
+
+			Convey("The cookies which would exceed the budget are dropped", func() {
+				cookies := rec.Result().Cookies()
+				So(cookies, ShouldHaveLength, 3)
+				So(cookies[0].Value, ShouldStartWith, "a")
+				So(cookies[1].Value, ShouldStartWith, "b")
+				So(cookies[2].Name, ShouldEqual, localeCookieKey)
+				So(CheckResponseCookieBudget(rec.Header(), DefaultResponseCookieBudget), ShouldBeNil)
+				So(l.events, ShouldHaveLength, 1)
+				So(errors.Is(l.events[0].Err, ErrCookieBudgetExceeded), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the budget is zero", func() {
+			validation.Budget = 0
+			rec := serve(httptest.NewRequest(http.MethodGet, "https://www.ons.gov.uk/", http.NoBody), func(w http.ResponseWriter, _ *http.Request) {
+				for _, name := range []string{"a", "b", "c"} {
+					SetCollection(w, strings.Repeat(name, 3000), "www.ons.gov.uk")
+				}
+			})
+
+			Convey("It is not checked", func() {
+				So(rec.Result().Cookies(), ShouldHaveLength, 3)
+			})
+		})
+	})
+}
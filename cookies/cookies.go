@@ -1,7 +1,9 @@
 package cookies
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -44,6 +46,9 @@ const (
 	// collectionIDCookieKey is the name of cookie set by Florence to store currenct active collection
 	collectionIDCookieKey = "collection"
 
+	// csrfCookieKey is the name of the cookie holding the signed token checked by the CSRF middleware
+	csrfCookieKey = "csrf_token"
+
 	// maxAgeOneYear is length of time to expire a cookie in a year
 	maxAgeOneYear = 31622400
 
@@ -51,6 +56,19 @@ const (
 	maxAgeBrowserSession = 0
 )
 
+// The names of the cookies written by this library, e.g. for finding them in a response
+const (
+	ONSPolicyCookieName         = onsCookiePolicyCookieKey
+	ONSPreferencesSetCookieName = onsCookiePreferencesSetCookieKey
+	LangCookieName              = localeCookieKey
+	UserAuthTokenCookieName     = florenceCookieKey
+	IDTokenCookieName           = idCookieKey
+	RefreshTokenCookieName      = refreshCookieKey
+	ABTestCookieName            = aBTestKey
+	CollectionCookieName        = collectionIDCookieKey
+	CSRFCookieName              = string(HostPrefix) + csrfCookieKey
+)
+
 var isRunningLocalDev bool
 
 func init() { //nolint:gochecknoinits // init() is used for local/ci testing only
@@ -66,11 +84,26 @@ func init() { //nolint:gochecknoinits // init() is used for local/ci testing onl
 }
 
 func set(w http.ResponseWriter, name, value, domain, path string, maxAge int, sameSite http.SameSite, httpOnly bool) {
-	encodedValue := url.QueryEscape(value)
+	logSetError(context.Background(), name, trySet(w, name, value, domain, path, maxAge, sameSite, httpOnly))
+}
 
+// trySet sets a cookie with the value url encoded, returning an error if the cookie is invalid
+func trySet(w http.ResponseWriter, name, value, domain, path string, maxAge int, sameSite http.SameSite, httpOnly bool) error {
+	return trySetUnencoded(w, name, url.QueryEscape(value), domain, path, maxAge, sameSite, httpOnly)
+}
+
+// setCookieWithUnencodedValue sets a cookie with the value not encoded. The value must not contain characters which
+// are invalid in a cookie, such as '"' or ';', otherwise the cookie is not set.
+func setCookieWithUnencodedValue(w http.ResponseWriter, name, value, domain, path string, maxAge int, sameSite http.SameSite, httpOnly bool) {
+	logSetError(context.Background(), name, trySetUnencoded(w, name, value, domain, path, maxAge, sameSite, httpOnly))
+}
+
+// trySetUnencoded sets a cookie with the value not encoded, returning an error if the cookie is invalid. Unlike
+// http.SetCookie the value is never quoted, e.g. when it contains a comma.
+func trySetUnencoded(w http.ResponseWriter, name, value, domain, path string, maxAge int, sameSite http.SameSite, httpOnly bool) error {
 	cookie := &http.Cookie{
 		Name:     name,
-		Value:    encodedValue,
+		Value:    value,
 		Path:     path,
 		Domain:   domain,
 		HttpOnly: httpOnly,
@@ -78,37 +111,70 @@ func set(w http.ResponseWriter, name, value, domain, path string, maxAge int, sa
 		MaxAge:   maxAge,
 		SameSite: sameSite,
 	}
-	http.SetCookie(w, cookie)
+	partition(cookie)
+	return writeCookie(w, cookie)
 }
 
-// setCookieWithUnencodedValue sets a cookie with the value not encoded
-func setCookieWithUnencodedValue(w http.ResponseWriter, name, value, domain, path string, maxAge int, sameSite http.SameSite, httpOnly bool) {
-	convertedValue := strings.ReplaceAll(value, "\"", "'")
+// logSetError logs an error returned when setting a cookie, for the setters which do not return errors
+func logSetError(ctx context.Context, name string, err error) {
+	if err != nil {
+		getLogger().Error(ctx, "cookie not set", err, logData{"name": name})
+	}
+}
 
+// expire removes a cookie from the browser by setting it with a negative max age. Partitioned cookies are expired
+// with the Partitioned attribute, as otherwise the browser treats them as a different cookie.
+func expire(w http.ResponseWriter, name, domain, path string) {
 	cookie := &http.Cookie{
-		Name:     name,
-		Value:    convertedValue,
-		Path:     path,
-		Domain:   domain,
-		HttpOnly: httpOnly,
-		Secure:   isRunningLocalDev,
-		MaxAge:   maxAge,
-		SameSite: sameSite,
+		Name:   name,
+		Path:   path,
+		Domain: domain,
+		Secure: isRunningLocalDev,
+		MaxAge: -1,
+	}
+	partition(cookie)
+	http.SetCookie(w, cookie)
+}
+
+// withRequestCookies returns a shallow copy of the request with the given cookie values replacing any of the same name,
+// so that handlers further down the chain read the cookies written in this response. Values are used verbatim, as
+// http.Request.AddCookie would quote the unencoded JSON of the ONS policy.
+func withRequestCookies(req *http.Request, values map[string]string) *http.Request {
+	pairs := make([]string, 0, len(values))
+	for _, c := range req.Cookies() {
+		if _, ok := values[c.Name]; !ok {
+			pairs = append(pairs, c.Name+"="+c.Value)
+		}
+	}
+	for name, value := range values {
+		pairs = append(pairs, name+"="+value)
 	}
 
-	// not using http.SetCookie as it adds quotes around the value if there is a comma within the value
-	// https://github.com/golang/go/blob/9b842e2e63b660dd5e9ac39bac58a578d7b69824/src/net/http/cookie.go#L465 (line 465)
-	cookieStr := cookie.String()
-	// strips quotes from a value that surround {} once which should be the value as that's how cookie.String() is constructed
-	cookieStr = strings.Replace(cookieStr, "\"{", "{", 1)
-	cookieStr = strings.Replace(cookieStr, "}\"", "}", 1)
-	w.Header().Add("Set-Cookie", cookieStr)
+	r := req.Clone(req.Context())
+	r.Header.Set("Cookie", strings.Join(pairs, "; "))
+	return r
 }
 
+// get returns the value of the named cookie, url decoded as written by set, so a '+' becomes a space and %XX escapes
+// are decoded in any value. Only a value which is not valid url encoding, e.g. with a lone '%', is returned unchanged.
 func get(req *http.Request, name string) (string, error) {
 	cookie, err := req.Cookie(name)
 	if err != nil {
 		return "", fmt.Errorf("could not find cookie named '%v'", name)
 	}
-	return cookie.Value, nil
+
+	value, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return cookie.Value, nil
+	}
+	return value, nil
+}
+
+// requestHost returns the lower case host of the request, without a port
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
 }
@@ -3,6 +3,7 @@ package cookies
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -51,6 +52,17 @@ func TestUnitCookie(t *testing.T) {
 		So(header, ShouldEqual, "test_cookie={'testValue':true,'otherValue':false}; Path=/; Domain=www.test.com; Max-Age=12; Secure; SameSite=Lax")
 	})
 
+	Convey("expire removes the cookie", t, func() {
+		rec := httptest.NewRecorder()
+		expire(rec, testCookie, testDomain, "/")
+		cookie := rec.Result().Cookies()[0]
+		So(cookie.Name, ShouldEqual, testCookie)
+		So(cookie.Value, ShouldBeEmpty)
+		So(cookie.Path, ShouldEqual, "/")
+		So(cookie.Domain, ShouldEqual, testDomain)
+		So(cookie.MaxAge, ShouldEqual, -1)
+	})
+
 	Convey("Get", t, func() {
 		Convey("returns cookie value if value is set", func() {
 			req := httptest.NewRequest("GET", "/", http.NoBody)
@@ -59,6 +71,27 @@ func TestUnitCookie(t *testing.T) {
 			So(cookie, ShouldEqual, "test-value")
 		})
 
+		Convey("decodes a value encoded by set", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: "test-cookie", Value: url.QueryEscape("a+b/c=d")})
+			cookie, _ := get(req, "test-cookie")
+			So(cookie, ShouldEqual, "a+b/c=d")
+		})
+
+		Convey("decodes a value which was not encoded by set", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: "test-cookie", Value: "a+b%2F"})
+			cookie, _ := get(req, "test-cookie")
+			So(cookie, ShouldEqual, "a b/")
+		})
+
+		Convey("returns a value which is not valid url encoding unchanged", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: "test-cookie", Value: "100%"})
+			cookie, _ := get(req, "test-cookie")
+			So(cookie, ShouldEqual, "100%")
+		})
+
 		Convey("returns error if no cookie is set", func() {
 			req := httptest.NewRequest("GET", "/", http.NoBody)
 			_, err := GetLang(req)
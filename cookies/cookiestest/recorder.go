@@ -0,0 +1,180 @@
+// Package cookiestest provides utilities for testing code which reads and writes cookies using the cookies package.
+package cookiestest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+)
+
+// Recorder is a httptest.ResponseRecorder which exposes the cookies written to it as typed values
+type Recorder struct {
+	*httptest.ResponseRecorder
+}
+
+// Attributes are the attributes of a cookie which can be asserted on using AssertAttributes
+type Attributes struct {
+	Path        string
+	Domain      string
+	MaxAge      int
+	SameSite    http.SameSite
+	HTTPOnly    bool
+	Secure      bool
+	Partitioned bool
+}
+
+// NewRecorder returns an initialised Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+// SetCookies returns every cookie written to the response, in the order they were written. Unlike
+// http.Response.Cookies, a header which cannot be parsed is reported rather than dropped.
+func (r *Recorder) SetCookies() ([]*http.Cookie, error) {
+	headers := r.Header().Values("Set-Cookie")
+	written := make([]*http.Cookie, 0, len(headers))
+	for _, h := range headers {
+		c, err := http.ParseSetCookie(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Set-Cookie header %q: %w", h, err)
+		}
+		written = append(written, c)
+	}
+
+	return written, nil
+}
+
+// Cookie returns the last cookie with the given name written to the response
+func (r *Recorder) Cookie(name string) (*http.Cookie, error) {
+	written, err := r.SetCookies()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(written) - 1; i >= 0; i-- {
+		if written[i].Name == name {
+			return written[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("cookie %q was not written to the response", name)
+}
+
+// ONSPolicy returns the policy written to the ons_cookie_policy cookie
+func (r *Recorder) ONSPolicy() (cookies.ONSPolicy, error) {
+	v, err := r.decode(cookies.ONSPolicyCookieName)
+	if err != nil {
+		return cookies.ONSPolicy{}, err
+	}
+	return v.(cookies.ONSPolicy), nil
+}
+
+// ONSPreferencesSet returns the value written to the ons_cookie_message_displayed cookie
+func (r *Recorder) ONSPreferencesSet() (bool, error) {
+	v, err := r.decode(cookies.ONSPreferencesSetCookieName)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// ABTest returns every aspect written to the ab_test cookie, keyed by aspect ID
+func (r *Recorder) ABTest() (map[string]cookies.ABTestCookieAspect, error) {
+	v, err := r.decode(cookies.ABTestCookieName)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]cookies.ABTestCookieAspect), nil
+}
+
+// Lang returns the decoded value written to the lang cookie
+func (r *Recorder) Lang() (string, error) {
+	return r.decodeString(cookies.LangCookieName)
+}
+
+// Collection returns the decoded value written to the collection cookie
+func (r *Recorder) Collection() (string, error) {
+	return r.decodeString(cookies.CollectionCookieName)
+}
+
+// UserAuthToken returns the decoded value written to the access_token cookie
+func (r *Recorder) UserAuthToken() (string, error) {
+	return r.decodeString(cookies.UserAuthTokenCookieName)
+}
+
+// IDToken returns the decoded value written to the id_token cookie
+func (r *Recorder) IDToken() (string, error) {
+	return r.decodeString(cookies.IDTokenCookieName)
+}
+
+// RefreshToken returns the decoded value written to the refresh_token cookie
+func (r *Recorder) RefreshToken() (string, error) {
+	return r.decodeString(cookies.RefreshTokenCookieName)
+}
+
+// AssertAttributes returns an error describing every attribute of the named cookie which does not match want
+func (r *Recorder) AssertAttributes(name string, want Attributes) error {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+
+	got := Attributes{
+		Path:        c.Path,
+		Domain:      c.Domain,
+		MaxAge:      c.MaxAge,
+		SameSite:    c.SameSite,
+		HTTPOnly:    c.HttpOnly,
+		Secure:      c.Secure,
+		Partitioned: c.Partitioned,
+	}
+	if got != want {
+		return fmt.Errorf("cookie %q has attributes %+v, expected %+v", name, got, want)
+	}
+
+	return nil
+}
+
+// AssertRegistered returns the mismatches between the named cookie and its definition in the cookies registry
+func (r *Recorder) AssertRegistered(name string) []error {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return []error{err}
+	}
+
+	definition, ok := cookies.Lookup(name)
+	if !ok {
+		return []error{fmt.Errorf("cookie %q is not in the registry", name)}
+	}
+
+	return definition.Check(c)
+}
+
+func (r *Recorder) decode(name string) (interface{}, error) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return nil, err
+	}
+
+	definition, ok := cookies.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("cookie %q is not in the registry", name)
+	}
+
+	v, err := definition.Decode(c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for cookie %q: %w", name, err)
+	}
+
+	return v, nil
+}
+
+func (r *Recorder) decodeString(name string) (string, error) {
+	v, err := r.decode(name)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
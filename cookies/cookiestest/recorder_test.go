@@ -0,0 +1,141 @@
+package cookiestest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testDomain = "www.ons.gov.uk"
+
+func TestRecorder(t *testing.T) {
+	Convey("Given cookies written by the cookies package", t, func() {
+		rec := NewRecorder()
+		policy := cookies.ONSPolicy{Essential: true, Settings: true, Campaigns: true}
+		aspect := cookies.ABTestCookieAspect{New: cookies.MustParseCookieTime("2021-01-02T15:31:23"), Old: cookies.MustParseCookieTime("2021-01-01T15:31:23")}
+		cookies.SetONSPolicy(rec, policy, testDomain)
+		cookies.SetONSPreferenceIsSet(rec, testDomain)
+		cookies.SetLang(rec, "cy", testDomain)
+		cookies.SetABTestCookieAspect(rec, httptest.NewRequest("GET", "/", http.NoBody), "aspect", testDomain, aspect)
+		cookies.SetCollection(rec, "collection 123", testDomain)
+		cookies.SetUserAuthToken(rec, "access", testDomain)
+		cookies.SetIDToken(rec, "id", testDomain)
+		cookies.SetRefreshToken(rec, "refresh", testDomain)
+
+		Convey("The unquoted JSON ONS policy is decoded", func() {
+			v, err := rec.ONSPolicy()
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, policy)
+
+			set, err := rec.ONSPreferencesSet()
+			So(err, ShouldBeNil)
+			So(set, ShouldBeTrue)
+		})
+
+		Convey("The a/b test aspects are decoded", func() {
+			v, err := rec.ABTest()
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, map[string]cookies.ABTestCookieAspect{"aspect": aspect})
+		})
+
+		Convey("String values are unescaped", func() {
+			lang, err := rec.Lang()
+			So(err, ShouldBeNil)
+			So(lang, ShouldEqual, "cy")
+
+			collection, err := rec.Collection()
+			So(err, ShouldBeNil)
+			So(collection, ShouldEqual, "collection 123")
+
+			access, _ := rec.UserAuthToken()
+			id, _ := rec.IDToken()
+			refresh, _ := rec.RefreshToken()
+			So([]string{access, id, refresh}, ShouldResemble, []string{"access", "id", "refresh"})
+		})
+
+		Convey("AssertAttributes passes for matching attributes", func() {
+			err := rec.AssertAttributes("refresh_token", Attributes{
+				Path:     "/api/v1/tokens/self",
+				Domain:   testDomain,
+				SameSite: http.SameSiteStrictMode,
+				HTTPOnly: true,
+				Secure:   true,
+			})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("AssertAttributes describes mismatching attributes", func() {
+			err := rec.AssertAttributes("lang", Attributes{Path: "/"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `cookie "lang" has attributes`)
+		})
+
+		Convey("Every cookie matches the registry", func() {
+			for _, name := range []string{cookies.ONSPolicyCookieName, cookies.ONSPreferencesSetCookieName, cookies.LangCookieName, cookies.ABTestCookieName, cookies.CollectionCookieName, cookies.UserAuthTokenCookieName, cookies.IDTokenCookieName, cookies.RefreshTokenCookieName} {
+				So(rec.AssertRegistered(name), ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("Given a cookie is written twice", t, func() {
+		rec := NewRecorder()
+		cookies.SetLang(rec, "en", testDomain)
+		cookies.SetLang(rec, "cy", testDomain)
+
+		Convey("The last value written is returned", func() {
+			lang, err := rec.Lang()
+			So(err, ShouldBeNil)
+			So(lang, ShouldEqual, "cy")
+		})
+	})
+
+	Convey("Given no cookies are written", t, func() {
+		rec := NewRecorder()
+
+		Convey("An error is returned", func() {
+			_, err := rec.ONSPolicy()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `cookie "ons_cookie_policy" was not written to the response`)
+			So(rec.AssertRegistered(cookies.LangCookieName), ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Given a cookie with an invalid value", t, func() {
+		rec := NewRecorder()
+		rec.Header().Add("Set-Cookie", "ab_test=not-json; Path=/")
+
+		Convey("An error is returned", func() {
+			_, err := rec.ABTest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, `invalid value for cookie "ab_test"`)
+		})
+	})
+
+	Convey("Given a Set-Cookie header which cannot be parsed", t, func() {
+		rec := NewRecorder()
+		rec.Header().Add("Set-Cookie", "no-value")
+
+		Convey("SetCookies reports it", func() {
+			_, err := rec.SetCookies()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRecorderWithABTestHandler(t *testing.T) {
+	Convey("Given a request served by the a/b test handler", t, func() {
+		handler := cookies.Handler(true, http.NotFoundHandler(), http.NotFoundHandler(), 100, "aspect", testDomain, "exit")
+		rec := NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", http.NoBody))
+
+		Convey("The aspect is assigned to the new variant", func() {
+			v, err := rec.ABTest()
+			So(err, ShouldBeNil)
+			So(v["aspect"].Variant(time.Now()), ShouldEqual, cookies.ABTestVariantNew)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package cookiestest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+)
+
+// RequestOption writes cookies to a response, which AddCookies then copies onto a request
+type RequestOption func(w http.ResponseWriter, req *http.Request)
+
+// NewRequest returns a httptest request carrying the cookies written by each of the options, exactly as a
+// browser would send them back
+func NewRequest(method, target string, opts ...RequestOption) *http.Request {
+	req := httptest.NewRequest(method, target, http.NoBody)
+	AddCookies(req, opts...)
+
+	return req
+}
+
+// AddCookies applies each option in turn and copies the cookies it writes onto the request, replacing any
+// cookie of the same name. Cookie values are copied verbatim, as http.Request.AddCookie would quote the
+// unencoded JSON written by cookies.SetONSPolicy.
+func AddCookies(req *http.Request, opts ...RequestOption) {
+	for _, opt := range opts {
+		rec := NewRecorder()
+		opt(rec, req)
+
+		written, err := rec.SetCookies()
+		if err != nil {
+			panic(err)
+		}
+		for _, c := range written {
+			setRequestCookie(req, c.Name, c.Value)
+		}
+	}
+}
+
+// WithONSPolicy adds the ons_cookie_policy cookie and the ons_cookie_message_displayed cookie
+func WithONSPolicy(policy cookies.ONSPolicy) RequestOption {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cookies.SetONSPolicy(w, policy, "")  //nolint:staticcheck // test cookies are not consent given by a user
+		cookies.SetONSPreferenceIsSet(w, "") //nolint:staticcheck // test cookies are not consent given by a user
+	}
+}
+
+// WithLang adds the lang cookie
+func WithLang(lang string) RequestOption {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cookies.SetLang(w, lang, "")
+	}
+}
+
+// WithABTestAspect adds the aspect to the ab_test cookie, keeping any aspects added by earlier options
+func WithABTestAspect(aspectID string, aspect cookies.ABTestCookieAspect) RequestOption {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cookies.SetABTestCookieAspect(w, req, aspectID, "", aspect)
+	}
+}
+
+// WithCollection adds the collection cookie
+func WithCollection(collectionID string) RequestOption {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cookies.SetCollection(w, collectionID, "")
+	}
+}
+
+// WithUserAuthToken adds the access_token cookie
+func WithUserAuthToken(token string) RequestOption {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cookies.SetUserAuthToken(w, token, "")
+	}
+}
+
+// WithIDToken adds the id_token cookie
+func WithIDToken(token string) RequestOption {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cookies.SetIDToken(w, token, "")
+	}
+}
+
+// WithRefreshToken adds the refresh_token cookie
+func WithRefreshToken(token string) RequestOption {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cookies.SetRefreshToken(w, token, "")
+	}
+}
+
+// setRequestCookie replaces the named cookie in the request's Cookie header
+func setRequestCookie(req *http.Request, name, value string) {
+	pairs := []string{}
+	for _, c := range req.Cookies() {
+		if c.Name != name {
+			pairs = append(pairs, c.Name+"="+c.Value)
+		}
+	}
+	pairs = append(pairs, name+"="+value)
+
+	req.Header.Set("Cookie", strings.Join(pairs, "; "))
+}
@@ -0,0 +1,64 @@
+package cookiestest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ONSdigital/dp-cookies/cookies"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewRequest(t *testing.T) {
+	Convey("Given a request built with cookie options", t, func() {
+		policy := cookies.ONSPolicy{Essential: true, Usage: true}
+		first := cookies.ABTestCookieAspect{New: cookies.MustParseCookieTime("2021-01-02T15:31:23")}
+		second := cookies.ABTestCookieAspect{Old: cookies.MustParseCookieTime("2021-01-02T15:31:23")}
+		req := NewRequest(http.MethodGet, "/",
+			WithONSPolicy(policy),
+			WithLang("cy"),
+			WithABTestAspect("first", first),
+			WithABTestAspect("second", second),
+			WithCollection("collection-123"),
+			WithUserAuthToken("access"),
+			WithIDToken("id"),
+			WithRefreshToken("refresh"),
+		)
+
+		Convey("The cookies package reads back the ONS preferences", func() {
+			So(cookies.GetONSCookiePreferences(req), ShouldResemble, cookies.ONSPreferencesResponse{IsPreferenceSet: true, Policy: policy})
+		})
+
+		Convey("The unencoded policy is not quoted", func() {
+			c, err := req.Cookie(cookies.ONSPolicyCookieName)
+			So(err, ShouldBeNil)
+			So(c.Value, ShouldEqual, "{'essential':true,'settings':false,'usage':true,'campaigns':false}")
+		})
+
+		Convey("Every a/b test aspect is kept in the single ab_test cookie", func() {
+			aspects, err := cookies.GetABTestCookieAspects(req)
+			So(err, ShouldBeNil)
+			So(aspects, ShouldResemble, map[string]cookies.ABTestCookieAspect{"first": first, "second": second})
+			So(req.Cookies(), ShouldHaveLength, 8)
+		})
+
+		Convey("The remaining cookies are read back", func() {
+			lang, _ := cookies.GetLang(req)
+			collection, _ := cookies.GetCollection(req)
+			access, _ := cookies.GetUserAuthToken(req)
+			id, _ := cookies.GetIDToken(req)
+			refresh, _ := cookies.GetRefreshToken(req)
+			So([]string{lang, collection, access, id, refresh}, ShouldResemble, []string{"cy", "collection-123", "access", "id", "refresh"})
+		})
+	})
+
+	Convey("Given a cookie option applied twice", t, func() {
+		req := NewRequest(http.MethodGet, "/", WithLang("en"))
+		AddCookies(req, WithLang("cy"))
+
+		Convey("The later value replaces the earlier one", func() {
+			So(req.Cookies(), ShouldHaveLength, 1)
+			lang, _ := cookies.GetLang(req)
+			So(lang, ShouldEqual, "cy")
+		})
+	})
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"strconv"
 	"time"
-
-	"github.com/ONSdigital/log.go/v2/log"
 )
 
 type CookieTime struct {
@@ -41,7 +39,7 @@ func ParseCookieTime(datetime string) (CookieTime, error) {
 func MustParseCookieTime(date string) CookieTime {
 	d, err := ParseCookieTime(date)
 	if err != nil {
-		log.Fatal(context.Background(), "MustParseCookieTime", InvalidCookieTimeString{value: date})
+		getLogger().Error(context.Background(), "MustParseCookieTime", InvalidCookieTimeString{value: date}, nil)
 	}
 
 	return d
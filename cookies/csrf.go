@@ -0,0 +1,214 @@
+package cookies
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultCSRFHeader is the header checked for the CSRF token
+	DefaultCSRFHeader = "X-CSRF-Token"
+
+	// DefaultCSRFField is the form field checked for the CSRF token
+	DefaultCSRFField = "csrf_token"
+
+	// minCSRFKeySize is the smallest key CSRF tokens are signed with
+	minCSRFKeySize = 32
+
+	// csrfNonceSize is the number of random bytes in a CSRF token
+	csrfNonceSize = 32
+)
+
+var (
+	// ErrCSRFKeyTooShort is returned when the key CSRF tokens are signed with is shorter than 32 bytes
+	ErrCSRFKeyTooShort = errors.New("csrf key must be at least 32 bytes")
+
+	// ErrInvalidCSRFToken is returned when a CSRF token is not well formed
+	ErrInvalidCSRFToken = errors.New("invalid csrf token")
+)
+
+// CSRF is middleware protecting against cross-site request forgery using signed double-submit cookies. Every request
+// is given a __Host-csrf_token cookie, signed so that it cannot be forged, and requests with unsafe methods must submit
+// the same token in a header or form field. Templates embed the token with CSRFField, CSRFMeta or CSRFTemplateFuncs.
+//
+// The __Host- prefix means the cookie has no domain, so other subdomains of the site cannot set the token they submit.
+type CSRF struct {
+	// HeaderName is the header checked for the token
+	HeaderName string
+	// FieldName is the form field checked for the token, when it is not in the header
+	FieldName string
+	// ExemptPaths are the paths, including the paths below them, of requests which are not checked, e.g. for webhooks
+	ExemptPaths []string
+	// Exempt, when set, reports whether a request is not checked
+	Exempt func(req *http.Request) bool
+	// ErrorHandler serves requests which fail the check, by default with a 403 Forbidden
+	ErrorHandler http.Handler
+
+	key []byte
+}
+
+// csrfContextKey is the request context key of the csrfContext
+type csrfContextKey struct{}
+
+// csrfContext is the token given to a request, and where it is submitted
+type csrfContext struct {
+	token     string
+	fieldName string
+}
+
+// NewCSRF returns CSRF middleware signing tokens with the key, which must be at least 32 bytes and the same for every
+// instance of the service
+func NewCSRF(key []byte) (*CSRF, error) {
+	if len(key) < minCSRFKeySize {
+		return nil, ErrCSRFKeyTooShort
+	}
+	return &CSRF{
+		HeaderName: DefaultCSRFHeader,
+		FieldName:  DefaultCSRFField,
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, ErrInvalidCSRFToken.Error(), http.StatusForbidden)
+		}),
+		key: append([]byte(nil), key...),
+	}, nil
+}
+
+// Middleware sets the __Host-csrf_token cookie when the request does not have a valid one, and checks the token
+// submitted with requests using unsafe methods before calling next
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// only the prefixed cookie is read, as a csrf_token cookie could have been set by another subdomain
+		token, err := get(req, CSRFCookieName)
+		valid := err == nil && c.verify(token)
+		if !valid {
+			token = c.newToken()
+			path := "/"
+			httpOnly := true
+			err := trySetPrefixed(w, HostPrefix, csrfCookieKey, token, "", path, maxAgeBrowserSession, http.SameSiteLaxMode, httpOnly)
+			logSetError(req.Context(), CSRFCookieName, err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), csrfContextKey{}, csrfContext{token: token, fieldName: c.FieldName}))
+
+		if isSafeMethod(req.Method) || c.isExempt(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		// a token which was not valid has been replaced, so cannot have been submitted
+		if !valid || !hmac.Equal([]byte(c.submitted(req)), []byte(token)) {
+			getLogger().Info(req.Context(), "request rejected by csrf check", logData{"method": req.Method, "path": req.URL.Path})
+			c.ErrorHandler.ServeHTTP(w, req)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// newToken returns a random nonce and its signature
+func (c *CSRF) newToken() string {
+	nonce := make([]byte, csrfNonceSize)
+	_, _ = rand.Read(nonce) // never returns an error
+	return base64.RawURLEncoding.EncodeToString(nonce) + "." + base64.RawURLEncoding.EncodeToString(c.sign(nonce))
+}
+
+// verify reports whether the token was signed with the key
+func (c *CSRF) verify(token string) bool {
+	nonce, signature, err := splitCSRFToken(token)
+	return err == nil && hmac.Equal(signature, c.sign(nonce))
+}
+
+func (c *CSRF) sign(nonce []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// submitted returns the token submitted in the header, or else the form field
+func (c *CSRF) submitted(req *http.Request) string {
+	if token := req.Header.Get(c.HeaderName); token != "" {
+		return token
+	}
+	return req.PostFormValue(c.FieldName)
+}
+
+// isExempt reports whether the request is to one of the exempt paths, or a path below one, or is exempted by Exempt
+func (c *CSRF) isExempt(req *http.Request) bool {
+	for _, exempt := range c.ExemptPaths {
+		exempt = strings.TrimSuffix(exempt, "/")
+		if req.URL.Path == exempt || strings.HasPrefix(req.URL.Path, exempt+"/") {
+			return true
+		}
+	}
+	return c.Exempt != nil && c.Exempt(req)
+}
+
+// isSafeMethod reports whether the method does not change state, as defined by RFC 9110
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// splitCSRFToken returns the decoded nonce and signature of a CSRF token
+func splitCSRFToken(token string) (nonce, signature []byte, err error) {
+	encodedNonce, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, nil, ErrInvalidCSRFToken
+	}
+	nonce, err = base64.RawURLEncoding.DecodeString(encodedNonce)
+	if err != nil || len(nonce) != csrfNonceSize {
+		return nil, nil, ErrInvalidCSRFToken
+	}
+	signature, err = base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || len(signature) != sha256.Size {
+		return nil, nil, ErrInvalidCSRFToken
+	}
+	return nonce, signature, nil
+}
+
+// CSRFToken returns the CSRF token of a request served by the CSRF middleware, or an empty string
+func CSRFToken(req *http.Request) string {
+	csrf, _ := req.Context().Value(csrfContextKey{}).(csrfContext)
+	return csrf.token
+}
+
+// CSRFField returns a hidden form input holding the CSRF token of a request served by the CSRF middleware
+func CSRFField(req *http.Request) template.HTML {
+	csrf, ok := req.Context().Value(csrfContextKey{}).(csrfContext)
+	if !ok {
+		return ""
+	}
+	//nolint:gosec // the field name is configured by the service and the token is escaped
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(csrf.fieldName) + `" value="` + template.HTMLEscapeString(csrf.token) + `">`)
+}
+
+// CSRFMeta returns a meta element holding the CSRF token of a request served by the CSRF middleware, for scripts to
+// send in the CSRF header
+func CSRFMeta(req *http.Request) template.HTML {
+	token := CSRFToken(req)
+	if token == "" {
+		return ""
+	}
+	//nolint:gosec // the token is escaped
+	return template.HTML(`<meta name="csrf-token" content="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// CSRFTemplateFuncs returns the csrfToken, csrfField and csrfMeta template functions for a request served by the CSRF
+// middleware
+func CSRFTemplateFuncs(req *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return CSRFToken(req) },
+		"csrfField": func() template.HTML { return CSRFField(req) },
+		"csrfMeta":  func() template.HTML { return CSRFMeta(req) },
+	}
+}
@@ -0,0 +1,204 @@
+package cookies
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var testCSRFKey = []byte("test-csrf-key-which-is-32-bytes!")
+
+// csrfRequest returns a request carrying the __Host-csrf_token cookie written to rec, if any
+func csrfRequest(rec *httptest.ResponseRecorder, method, target string, body *strings.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return req
+}
+
+func TestCSRF(t *testing.T) {
+	Convey("Given a key shorter than 32 bytes", t, func() {
+		_, err := NewCSRF([]byte("short"))
+		So(err, ShouldEqual, ErrCSRFKeyTooShort)
+	})
+
+	Convey("Given the CSRF middleware", t, func() {
+		csrf, err := NewCSRF(testCSRFKey)
+		So(err, ShouldBeNil)
+		var served []string
+		handler := csrf.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			served = append(served, CSRFToken(req))
+		}))
+
+		first := httptest.NewRecorder()
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+		token := first.Result().Cookies()[0].Value
+
+		Convey("A safe request is given a signed token cookie", func() {
+			So(served, ShouldResemble, []string{token})
+			So(csrf.verify(token), ShouldBeTrue)
+
+			c := first.Result().Cookies()[0]
+			d, _ := Lookup(c.Name)
+			So(c.Name, ShouldEqual, "__Host-csrf_token")
+			So(c.Domain, ShouldBeEmpty)
+			So(c.Secure, ShouldBeTrue)
+			So(d.Check(c), ShouldBeEmpty)
+		})
+
+		Convey("A request with a valid token cookie keeps its token", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, csrfRequest(first, http.MethodGet, "/", strings.NewReader("")))
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			So(served[1], ShouldEqual, token)
+		})
+
+		Convey("A request with a token signed by another key is given a new token", func() {
+			other, _ := NewCSRF([]byte("another-csrf-key-of-32-bytes-!!!"))
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: other.newToken()})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Result().Cookies(), ShouldHaveLength, 1)
+			So(csrf.verify(served[1]), ShouldBeTrue)
+		})
+
+		Convey("An unsafe request submitting the token in the header is served", func() {
+			req := csrfRequest(first, http.MethodPost, "/", strings.NewReader(""))
+			req.Header.Set(DefaultCSRFHeader, token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(served, ShouldHaveLength, 2)
+		})
+
+		Convey("An unsafe request submitting the token in the form is served", func() {
+			req := csrfRequest(first, http.MethodPost, "/", strings.NewReader(url.Values{DefaultCSRFField: {token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(served, ShouldHaveLength, 2)
+		})
+
+		Convey("An unsafe request submitting a different token is rejected", func() {
+			req := csrfRequest(first, http.MethodDelete, "/", strings.NewReader(""))
+			req.Header.Set(DefaultCSRFHeader, csrf.newToken())
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+			So(served, ShouldHaveLength, 1)
+		})
+
+		Convey("An unsafe request without a token cookie is rejected, even when submitting a valid token", func() {
+			req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+			req.Header.Set(DefaultCSRFHeader, token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+			So(rec.Result().Cookies(), ShouldHaveLength, 1)
+		})
+
+		Convey("An unsafe request with a valid token in a csrf_token cookie, e.g. set by another subdomain, is rejected", func() {
+			req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: csrfCookieKey, Value: token})
+			req.Header.Set(DefaultCSRFHeader, token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("An unsafe request with a forged token cookie and header is rejected", func() {
+			forged := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+			req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: forged})
+			req.Header.Set(DefaultCSRFHeader, forged)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("Exempt requests are not checked", func() {
+			csrf.ExemptPaths = []string{"/webhooks/", "/api/publish"}
+			csrf.Exempt = func(req *http.Request) bool { return req.Header.Get("Authorization") != "" }
+
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodPost, "/webhooks/publish", http.NoBody),
+				httptest.NewRequest(http.MethodPut, "/api", http.NoBody),
+			} {
+				if req.URL.Path == "/api" {
+					req.Header.Set("Authorization", "Bearer test-service-token")
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+			}
+			So(served, ShouldHaveLength, 3)
+		})
+
+		Convey("Exempt paths only match whole path segments", func() {
+			csrf.ExemptPaths = []string{"/webhooks/", "/api/publish"}
+
+			for _, path := range []string{"/webhooks", "/webhooks/publish", "/api/publish", "/api/publish/dataset"} {
+				So(csrf.isExempt(httptest.NewRequest(http.MethodPost, path, http.NoBody)), ShouldBeTrue)
+			}
+			for _, path := range []string{"/webhooksevil", "/api/publisher", "/api"} {
+				So(csrf.isExempt(httptest.NewRequest(http.MethodPost, path, http.NoBody)), ShouldBeFalse)
+			}
+		})
+
+		Convey("A configured error handler serves rejected requests", func() {
+			csrf.ErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", http.NoBody))
+			So(rec.Code, ShouldEqual, http.StatusTeapot)
+		})
+	})
+}
+
+func TestCSRFTemplateHelpers(t *testing.T) {
+	Convey("Given a request served by the CSRF middleware", t, func() {
+		csrf, _ := NewCSRF(testCSRFKey)
+		var req *http.Request
+		csrf.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			req = r
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+		token := CSRFToken(req)
+
+		Convey("The token is embedded in templates", func() {
+			tmpl := template.Must(template.New("form").Funcs(CSRFTemplateFuncs(req)).Parse(`{{csrfMeta}}<form>{{csrfField}}</form>{{csrfToken}}`))
+			var b bytes.Buffer
+			So(tmpl.Execute(&b, nil), ShouldBeNil)
+			So(b.String(), ShouldEqual, `<meta name="csrf-token" content="`+token+`"><form><input type="hidden" name="csrf_token" value="`+token+`"></form>`+token)
+		})
+	})
+
+	Convey("Given a request not served by the CSRF middleware", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+
+		Convey("Nothing is embedded", func() {
+			So(CSRFToken(req), ShouldBeEmpty)
+			So(CSRFField(req), ShouldBeEmpty)
+			So(CSRFMeta(req), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSplitCSRFToken(t *testing.T) {
+	Convey("Given malformed tokens", t, func() {
+		for _, token := range []string{"", "no-separator", "!.!", "AAAA.AAAA"} {
+			_, _, err := splitCSRFToken(token)
+			So(errors.Is(err, ErrInvalidCSRFToken), ShouldBeTrue)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package cookies
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNoFlorenceSession is returned by FlorenceSession.Load when none of the session's cookies are present
+	ErrNoFlorenceSession = errors.New("no florence session")
+
+	// ErrIncompleteFlorenceSession is matched by an IncompleteSessionError
+	ErrIncompleteFlorenceSession = errors.New("incomplete florence session")
+)
+
+// IncompleteSessionError is returned when some, but not all, of a Florence session's tokens are present
+type IncompleteSessionError struct {
+	// Missing are the names of the missing cookies
+	Missing []string
+}
+
+func (e *IncompleteSessionError) Error() string {
+	return fmt.Sprintf("%s: missing %s", ErrIncompleteFlorenceSession, strings.Join(e.Missing, ", "))
+}
+
+// Is reports whether target is ErrIncompleteFlorenceSession
+func (e *IncompleteSessionError) Is(target error) bool {
+	return target == ErrIncompleteFlorenceSession
+}
+
+// FlorenceSession is the access, id and refresh tokens of a user signed in to Florence, which are always saved, loaded
+// and cleared together
+type FlorenceSession struct {
+	Domain       string
+	AccessToken  string
+	IDToken      string
+	RefreshToken string
+	// Expiry sets when the access_token and id_token cookies expire, the refresh_token cookie always expires when the
+	// browser is closed
+	Expiry TokenExpiry
+	// AccessTokenPrefix and RefreshTokenPrefix are the name prefixes the access_token and refresh_token cookies are
+	// saved with, see TrySetUserAuthTokenWithPrefix. Load sets them to the prefixes of the cookies read.
+	AccessTokenPrefix  CookiePrefix
+	RefreshTokenPrefix CookiePrefix
+}
+
+// Save sets the access_token, id_token and refresh_token cookies, with the session's prefixes. No cookies are set when
+// a token is missing or a cookie is invalid.
+func (s *FlorenceSession) Save(w http.ResponseWriter) error {
+	if missing := s.missing(); len(missing) > 0 {
+		return &IncompleteSessionError{Missing: missing}
+	}
+
+	// the cookies are written to a buffer first, so that either all or none are set
+	buffer := headerWriter{header: http.Header{}}
+	if err := TrySetUserAuthTokenWithPrefix(buffer, s.AccessToken, s.Domain, s.AccessTokenPrefix, s.Expiry); err != nil {
+		return err
+	}
+	if err := TrySetIDTokenWithExpiry(buffer, s.IDToken, s.Domain, s.Expiry); err != nil {
+		return err
+	}
+	if err := TrySetRefreshTokenWithPrefix(buffer, s.RefreshToken, s.Domain, s.RefreshTokenPrefix); err != nil {
+		return err
+	}
+
+	for _, value := range buffer.header.Values("Set-Cookie") {
+		w.Header().Add("Set-Cookie", value)
+	}
+	return nil
+}
+
+// Load reads the session's tokens, and their prefixes, from the request, returning ErrNoFlorenceSession when none are
+// present, or an IncompleteSessionError naming the missing cookies when only some are. The tokens which are present are
+// always read.
+func (s *FlorenceSession) Load(req *http.Request) error {
+	s.AccessToken, _ = GetUserAuthToken(req)
+	s.IDToken, _ = GetIDToken(req)
+	s.RefreshToken, _ = GetRefreshToken(req)
+	s.AccessTokenPrefix = cookiePrefix(req, florenceCookieKey)
+	s.RefreshTokenPrefix = cookiePrefix(req, refreshCookieKey)
+
+	switch missing := s.missing(); len(missing) {
+	case 0:
+		return nil
+	case 3:
+		return ErrNoFlorenceSession
+	default:
+		return &IncompleteSessionError{Missing: missing}
+	}
+}
+
+// Clear expires the access_token, id_token and refresh_token cookies, including those written with a name prefix,
+// and empties the session's tokens
+func (s *FlorenceSession) Clear(w http.ResponseWriter) {
+	expire(w, florenceCookieKey, s.Domain, "/")
+	expire(w, idCookieKey, s.Domain, "/")
+	expire(w, refreshCookieKey, s.Domain, "/api/v1/tokens/self")
+	s.clearPrefixed(w)
+
+	s.AccessToken, s.IDToken, s.RefreshToken = "", "", ""
+}
+
+// clearPrefixed expires the token cookies written with a name prefix
+func (s *FlorenceSession) clearPrefixed(w http.ResponseWriter) {
+	expirePrefixed(w, HostPrefix, florenceCookieKey, "", "/")
+	expirePrefixed(w, SecurePrefix, florenceCookieKey, s.Domain, "/")
+	expirePrefixed(w, SecurePrefix, refreshCookieKey, s.Domain, "/api/v1/tokens/self")
+}
+
+// missing returns the names of the cookies whose tokens are empty
+func (s *FlorenceSession) missing() []string {
+	var missing []string
+	for name, token := range map[string]string{florenceCookieKey: s.AccessToken, idCookieKey: s.IDToken, refreshCookieKey: s.RefreshToken} {
+		if token == "" {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// headerWriter is a http.ResponseWriter which only keeps the headers written to it
+type headerWriter struct {
+	header http.Header
+}
+
+func (h headerWriter) Header() http.Header         { return h.header }
+func (h headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (h headerWriter) WriteHeader(int)             {}
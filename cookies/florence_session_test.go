@@ -0,0 +1,148 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlorenceSessionSave(t *testing.T) {
+	testDomain := "www.test.com"
+
+	Convey("Given a complete session", t, func() {
+		session := FlorenceSession{Domain: testDomain, AccessToken: "test-access-token", IDToken: "test-id-token", RefreshToken: "test-refresh-token"}
+		rec := httptest.NewRecorder()
+		err := session.Save(rec)
+
+		Convey("Each cookie is written as its setter writes it", func() {
+			expected := httptest.NewRecorder()
+			SetUserAuthToken(expected, "test-access-token", testDomain)
+			SetIDToken(expected, "test-id-token", testDomain)
+			SetRefreshToken(expected, "test-refresh-token", testDomain)
+
+			So(err, ShouldBeNil)
+			So(rec.Header().Values("Set-Cookie"), ShouldResemble, expected.Header().Values("Set-Cookie"))
+		})
+
+		Convey("The session is loaded from a request carrying the cookies", func() {
+			loaded := FlorenceSession{}
+			So(loaded.Load(browserRequest(rec)), ShouldBeNil)
+			So(loaded.AccessToken, ShouldEqual, "test-access-token")
+			So(loaded.IDToken, ShouldEqual, "test-id-token")
+			So(loaded.RefreshToken, ShouldEqual, "test-refresh-token")
+		})
+	})
+
+	Convey("Given a session without a refresh token", t, func() {
+		session := FlorenceSession{Domain: testDomain, AccessToken: "test-access-token", IDToken: "test-id-token"}
+		rec := httptest.NewRecorder()
+		err := session.Save(rec)
+
+		Convey("No cookies are written and the missing cookie is reported", func() {
+			var incomplete *IncompleteSessionError
+			So(errors.As(err, &incomplete), ShouldBeTrue)
+			So(incomplete.Missing, ShouldResemble, []string{refreshCookieKey})
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a session with a token which cannot be written", t, func() {
+		session := FlorenceSession{Domain: "invalid domain", AccessToken: "test-access-token", IDToken: "test-id-token", RefreshToken: "test-refresh-token"}
+		rec := httptest.NewRecorder()
+		err := session.Save(rec)
+
+		Convey("No cookies are written and the error is returned", func() {
+			So(errors.Is(err, ErrInvalidCookieDomain), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestFlorenceSessionLoad(t *testing.T) {
+	Convey("Given a request without any session cookies", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		session := FlorenceSession{}
+		err := session.Load(req)
+
+		Convey("ErrNoFlorenceSession is returned", func() {
+			So(err, ShouldEqual, ErrNoFlorenceSession)
+			So(errors.Is(err, ErrIncompleteFlorenceSession), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a request with only an access token", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: florenceCookieKey, Value: "test-access-token"})
+		session := FlorenceSession{}
+		err := session.Load(req)
+
+		Convey("The present token is read and the missing cookies are reported", func() {
+			So(session.AccessToken, ShouldEqual, "test-access-token")
+			So(errors.Is(err, ErrIncompleteFlorenceSession), ShouldBeTrue)
+
+			var incomplete *IncompleteSessionError
+			So(errors.As(err, &incomplete), ShouldBeTrue)
+			So(incomplete.Missing, ShouldResemble, []string{idCookieKey, refreshCookieKey})
+			So(err.Error(), ShouldEqual, "incomplete florence session: missing id_token, refresh_token")
+		})
+	})
+
+	Convey("Given a request with prefixed token cookies", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: "__Host-access_token", Value: "test-access-token"})
+		req.AddCookie(&http.Cookie{Name: idCookieKey, Value: "test-id-token"})
+		req.AddCookie(&http.Cookie{Name: "__Secure-refresh_token", Value: "test-refresh-token"})
+		session := FlorenceSession{}
+
+		Convey("The session is complete and has the cookies' prefixes", func() {
+			So(session.Load(req), ShouldBeNil)
+			So(session.AccessToken, ShouldEqual, "test-access-token")
+			So(session.RefreshToken, ShouldEqual, "test-refresh-token")
+			So(session.AccessTokenPrefix, ShouldEqual, HostPrefix)
+			So(session.RefreshTokenPrefix, ShouldEqual, SecurePrefix)
+		})
+
+		Convey("Saving the session keeps the prefixes", func() {
+			So(session.Load(req), ShouldBeNil)
+			session.Domain = "www.test.com"
+			rec := httptest.NewRecorder()
+			So(session.Save(rec), ShouldBeNil)
+
+			written := writtenCookies(rec)
+			So(written, ShouldHaveLength, 3)
+			So(written, ShouldContainKey, "__Host-access_token")
+			So(written, ShouldContainKey, idCookieKey)
+			So(written, ShouldContainKey, "__Secure-refresh_token")
+		})
+	})
+}
+
+func TestFlorenceSessionClear(t *testing.T) {
+	Convey("Given a saved session", t, func() {
+		session := FlorenceSession{Domain: "www.test.com", AccessToken: "test-access-token", IDToken: "test-id-token", RefreshToken: "test-refresh-token"}
+		rec := httptest.NewRecorder()
+		session.Clear(rec)
+
+		Convey("Every token cookie is expired, including prefixed cookies", func() {
+			So(rec.Header().Values("Set-Cookie"), ShouldResemble, []string{
+				"access_token=; Path=/; Domain=www.test.com; Max-Age=0; Secure",
+				"id_token=; Path=/; Domain=www.test.com; Max-Age=0; Secure",
+				"refresh_token=; Path=/api/v1/tokens/self; Domain=www.test.com; Max-Age=0; Secure",
+				"__Host-access_token=; Path=/; Max-Age=0; Secure",
+				"__Secure-access_token=; Path=/; Domain=www.test.com; Max-Age=0; Secure",
+				"__Secure-refresh_token=; Path=/api/v1/tokens/self; Domain=www.test.com; Max-Age=0; Secure",
+			})
+		})
+
+		Convey("The session's tokens are emptied", func() {
+			So(session, ShouldResemble, FlorenceSession{Domain: "www.test.com"})
+		})
+
+		Convey("A request carrying the expired cookies has no session", func() {
+			So(session.Load(browserRequest(rec)), ShouldEqual, ErrNoFlorenceSession)
+		})
+	})
+}
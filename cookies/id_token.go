@@ -1,14 +1,18 @@
 package cookies
 
 import (
+	"context"
 	"net/http"
 )
 
 // SetIDToken sets a cookie containing users id token ("id_token")
 func SetIDToken(w http.ResponseWriter, idToken, domain string) {
-	path := "/"
-	httpOnly := false
-	set(w, idCookieKey, idToken, domain, path, maxAgeBrowserSession, http.SameSiteLaxMode, httpOnly)
+	logSetError(context.Background(), idCookieKey, TrySetIDToken(w, idToken, domain))
+}
+
+// TrySetIDToken sets a cookie containing users id token ("id_token"), returning an error if the cookie cannot be set
+func TrySetIDToken(w http.ResponseWriter, idToken, domain string) error {
+	return TrySetIDTokenWithExpiry(w, idToken, domain, SessionExpiry)
 }
 
 // GetIDToken reads id_token cookie and returns it's value
@@ -1,6 +1,7 @@
 package cookies
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -48,3 +49,27 @@ func TestUnitIDToken(t *testing.T) {
 		So(cookie, ShouldResemble, correctCookie)
 	})
 }
+
+func TestTrySetTokens(t *testing.T) {
+	Convey("Given valid tokens", t, func() {
+		rec := httptest.NewRecorder()
+
+		Convey("Each token cookie is set", func() {
+			So(TrySetIDToken(rec, "id", "www.test.com"), ShouldBeNil)
+			So(TrySetUserAuthToken(rec, "access", "www.test.com"), ShouldBeNil)
+			So(TrySetRefreshToken(rec, "refresh", "www.test.com"), ShouldBeNil)
+			So(rec.Result().Cookies(), ShouldHaveLength, 3)
+		})
+	})
+
+	Convey("Given an invalid domain", t, func() {
+		rec := httptest.NewRecorder()
+
+		Convey("Each setter returns an error", func() {
+			So(errors.Is(TrySetIDToken(rec, "id", "a..b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(errors.Is(TrySetUserAuthToken(rec, "access", "a..b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(errors.Is(TrySetRefreshToken(rec, "refresh", "a..b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
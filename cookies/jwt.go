@@ -0,0 +1,367 @@
+package cookies
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers the hashes of the supported algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidJWT is returned when a token is not a well formed JWT
+	ErrInvalidJWT = errors.New("invalid jwt")
+
+	// ErrUnsupportedJWTAlgorithm is returned when a token is signed with an algorithm other than RS256, RS384, RS512,
+	// ES256, ES384 or ES512
+	ErrUnsupportedJWTAlgorithm = errors.New("unsupported jwt algorithm")
+
+	// ErrUnknownJWTKey is returned when a token is signed with a key which is not in the key set
+	ErrUnknownJWTKey = errors.New("unknown jwt key")
+
+	// ErrInvalidJWTSignature is returned when a token's signature does not match its contents
+	ErrInvalidJWTSignature = errors.New("invalid jwt signature")
+
+	// ErrInvalidJWKS is returned when a JSON web key set cannot be parsed
+	ErrInvalidJWKS = errors.New("invalid jwks")
+)
+
+// maxJWTTime is the latest time claim accepted, 9999-12-31T23:59:59Z
+const maxJWTTime = 253402300799
+
+// ecCurves are the curves of the keys which must sign each ECDSA algorithm
+var ecCurves = map[string]string{
+	"ES256": elliptic.P256().Params().Name,
+	"ES384": elliptic.P384().Params().Name,
+	"ES512": elliptic.P521().Params().Name,
+}
+
+// Claims are the claims of an id_token or access_token JWT
+type Claims struct {
+	Subject  string
+	Email    string
+	Username string
+	Groups   []string
+	Issuer   string
+	// ExpiresAt is the time of the exp claim, or zero when the token does not expire
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	// Raw holds every claim in the token, with numbers as json.Number
+	Raw map[string]interface{}
+}
+
+// IsExpired reports whether the token has expired, or expires within the leeway, e.g. so that it is refreshed before
+// a request using it is rejected. A negative leeway allows for clock skew. Tokens without an exp claim never expire.
+func (c Claims) IsExpired(leeway time.Duration) bool {
+	return !c.ExpiresAt.IsZero() && !time.Now().Add(leeway).Before(c.ExpiresAt)
+}
+
+// GetIDTokenClaims returns the claims of the id_token cookie without verifying its signature
+func GetIDTokenClaims(req *http.Request) (Claims, error) {
+	token, err := GetIDToken(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	return ParseJWTClaims(token)
+}
+
+// GetUserAuthTokenClaims returns the claims of the access_token cookie without verifying its signature
+func GetUserAuthTokenClaims(req *http.Request) (Claims, error) {
+	token, err := GetUserAuthToken(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	return ParseJWTClaims(token)
+}
+
+// GetVerifiedIDTokenClaims returns the claims of the id_token cookie, once its signature is verified against the keys
+func GetVerifiedIDTokenClaims(req *http.Request, keys KeySet) (Claims, error) {
+	token, err := GetIDToken(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	return VerifyJWT(token, keys)
+}
+
+// GetVerifiedUserAuthTokenClaims returns the claims of the access_token cookie, once its signature is verified against
+// the keys
+func GetVerifiedUserAuthTokenClaims(req *http.Request, keys KeySet) (Claims, error) {
+	token, err := GetUserAuthToken(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	return VerifyJWT(token, keys)
+}
+
+// ParseJWTClaims returns the claims of a JWT without verifying its signature. The claims must not be trusted for
+// authorisation, use VerifyJWT instead.
+func ParseJWTClaims(token string) (Claims, error) {
+	_, payload, _, err := splitJWT(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	return parseClaims(payload)
+}
+
+// VerifyJWT verifies the signature of a JWT against the keys and returns its claims. Expiry is not checked, so that
+// callers can decide whether to refresh the token, see Claims.IsExpired.
+func VerifyJWT(token string, keys KeySet) (Claims, error) {
+	header, payload, signature, err := splitJWT(token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil {
+		return Claims{}, fmt.Errorf("%w: header: %w", ErrInvalidJWT, err)
+	}
+
+	key, err := keys.key(h.KeyID)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	signed := token[:strings.LastIndexByte(token, '.')]
+	if err := verifySignature(h.Algorithm, key, []byte(signed), signature); err != nil {
+		return Claims{}, err
+	}
+
+	return parseClaims(payload)
+}
+
+// splitJWT returns the decoded header, payload and signature of a JWT
+func splitJWT(token string) (header, payload, signature []byte, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, nil, fmt.Errorf("%w: expected 3 parts, found %d", ErrInvalidJWT, len(parts))
+	}
+
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+		}
+	}
+	return decoded[0], decoded[1], decoded[2], nil
+}
+
+func parseClaims(payload []byte) (Claims, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return Claims{}, fmt.Errorf("%w: payload: %w", ErrInvalidJWT, err)
+	}
+
+	claims := Claims{
+		Subject:  stringClaim(raw, "sub"),
+		Email:    stringClaim(raw, "email"),
+		Username: stringClaim(raw, "username", "cognito:username"),
+		Issuer:   stringClaim(raw, "iss"),
+		Raw:      raw,
+	}
+
+	var err error
+	if claims.ExpiresAt, err = timeClaim(raw, "exp"); err != nil {
+		return Claims{}, err
+	}
+	if claims.IssuedAt, err = timeClaim(raw, "iat"); err != nil {
+		return Claims{}, err
+	}
+
+	for _, name := range []string{"cognito:groups", "groups"} {
+		groups, ok := raw[name].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, group := range groups {
+			if s, ok := group.(string); ok {
+				claims.Groups = append(claims.Groups, s)
+			}
+		}
+		break
+	}
+
+	return claims, nil
+}
+
+// stringClaim returns the first of the named claims which is a string
+func stringClaim(raw map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if s, ok := raw[name].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// timeClaim returns the time of a NumericDate claim, or zero when the claim is not present
+func timeClaim(raw map[string]interface{}, name string) (time.Time, error) {
+	value, ok := raw[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s is not a number", ErrInvalidJWT, name)
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s: %w", ErrInvalidJWT, name, err)
+	}
+	if !(seconds >= 0 && seconds <= maxJWTTime) {
+		return time.Time{}, fmt.Errorf("%w: %s is out of range", ErrInvalidJWT, name)
+	}
+
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second))).UTC(), nil
+}
+
+func verifySignature(algorithm string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(algorithm) != 5 {
+		return fmt.Errorf("%w: %q", ErrUnsupportedJWTAlgorithm, algorithm)
+	}
+
+	var hash crypto.Hash
+	switch algorithm[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "RS") || hash == 0 {
+			return fmt.Errorf("%w: %q for rsa key", ErrUnsupportedJWTAlgorithm, algorithm)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest(hash, signed), signature); err != nil {
+			return ErrInvalidJWTSignature
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "ES") || hash == 0 {
+			return fmt.Errorf("%w: %q for ec key", ErrUnsupportedJWTAlgorithm, algorithm)
+		}
+		if curve := k.Curve.Params().Name; curve != ecCurves[algorithm] {
+			return fmt.Errorf("%w: %q for %s key", ErrUnsupportedJWTAlgorithm, algorithm, curve)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidJWTSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest(hash, signed), r, s) {
+			return ErrInvalidJWTSignature
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedJWTAlgorithm, algorithm)
+	}
+
+	return nil
+}
+
+func digest(hash crypto.Hash, b []byte) []byte {
+	h := hash.New()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// KeySet is the public keys JWTs are verified against, keyed by key ID
+type KeySet map[string]crypto.PublicKey
+
+// key returns the key with the ID, or the only key in the set when the token does not name a key
+func (ks KeySet) key(id string) (crypto.PublicKey, error) {
+	if id == "" && len(ks) == 1 {
+		for _, key := range ks {
+			return key, nil
+		}
+	}
+	key, ok := ks[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownJWTKey, id)
+	}
+	return key, nil
+}
+
+// ParseJWKS parses the RSA and EC keys of a JSON web key set, such as the contents of a Cognito user pool's
+// /.well-known/jwks.json. Keys of other types are ignored.
+func ParseJWKS(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWKS, err)
+	}
+
+	keys := make(KeySet, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch jwk.KeyType {
+		case "RSA":
+			n, err := decodeBigInt(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("%w: key %q: n: %w", ErrInvalidJWKS, jwk.KeyID, err)
+			}
+			e, err := decodeBigInt(jwk.E)
+			if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("%w: key %q: invalid e", ErrInvalidJWKS, jwk.KeyID)
+			}
+			keys[jwk.KeyID] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Curve]
+			if !ok {
+				return nil, fmt.Errorf("%w: key %q: unsupported curve %q", ErrInvalidJWKS, jwk.KeyID, jwk.Curve)
+			}
+			x, errX := decodeBigInt(jwk.X)
+			y, errY := decodeBigInt(jwk.Y)
+			if err := errors.Join(errX, errY); err != nil {
+				return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidJWKS, jwk.KeyID, err)
+			}
+			keys[jwk.KeyID] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,287 @@
+package cookies
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+// testJWKS returns the JSON web key set of the test keys, as served by a Cognito user pool
+func testJWKS() []byte {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	size := (elliptic.P256().Params().BitSize + 7) / 8
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-key", "use": "sig", "alg": "RS256", "n": encode(testRSAKey.N.Bytes()), "e": encode(big.NewInt(int64(testRSAKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-key", "use": "sig", "crv": "P-256", "x": encode(testECKey.X.FillBytes(make([]byte, size))), "y": encode(testECKey.Y.FillBytes(make([]byte, size)))},
+		{"kty": "RSA", "kid": "enc-key", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	return jwks
+}
+
+// signTestJWT returns a JWT of the claims signed by the test key for the algorithm
+func signTestJWT(algorithm, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch algorithm {
+	case "RS256":
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest(crypto.SHA256, []byte(signed)))
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, testECKey, digest(crypto.SHA256, []byte(signed)))
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testClaims(expiresAt time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":            "test-subject",
+		"email":          "test@ons.gov.uk",
+		"cognito:groups": []string{"role-admin", "role-publisher"},
+		"iss":            "https://cognito-idp.eu-west-2.amazonaws.com/test-pool",
+		"iat":            expiresAt.Add(-time.Hour).Unix(),
+		"exp":            expiresAt.Unix(),
+	}
+}
+
+func TestParseJWTClaims(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	Convey("Given an unverified JWT", t, func() {
+		token := signTestJWT("RS256", "unknown-key", testClaims(expiresAt))
+
+		Convey("The claims are parsed without the key", func() {
+			claims, err := ParseJWTClaims(token)
+			So(err, ShouldBeNil)
+			So(claims.Subject, ShouldEqual, "test-subject")
+			So(claims.Email, ShouldEqual, "test@ons.gov.uk")
+			So(claims.Groups, ShouldResemble, []string{"role-admin", "role-publisher"})
+			So(claims.Issuer, ShouldEqual, "https://cognito-idp.eu-west-2.amazonaws.com/test-pool")
+			So(claims.ExpiresAt, ShouldEqual, expiresAt)
+			So(claims.IssuedAt, ShouldEqual, expiresAt.Add(-time.Hour))
+			So(claims.Raw["token_use"], ShouldBeNil)
+		})
+	})
+
+	Convey("Given an access token with a username claim", t, func() {
+		token := signTestJWT("RS256", "rsa-key", map[string]interface{}{"username": "test-user", "token_use": "access"})
+
+		Convey("The username and raw claims are parsed", func() {
+			claims, err := ParseJWTClaims(token)
+			So(err, ShouldBeNil)
+			So(claims.Username, ShouldEqual, "test-user")
+			So(claims.Raw["token_use"], ShouldEqual, "access")
+			So(claims.ExpiresAt.IsZero(), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given tokens with time claims out of range", t, func() {
+		for _, exp := range []interface{}{-1, 1e19, 1e300, 253402300800} {
+			_, err := ParseJWTClaims(signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": exp}))
+			So(errors.Is(err, ErrInvalidJWT), ShouldBeTrue)
+		}
+	})
+
+	Convey("Given a token with a fractional time claim", t, func() {
+		claims, err := ParseJWTClaims(signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": 1700000000.5}))
+		So(err, ShouldBeNil)
+		So(claims.ExpiresAt, ShouldEqual, time.Unix(1700000000, 5e8).UTC())
+	})
+
+	Convey("Given tokens which are not JWTs", t, func() {
+		for _, token := range []string{"", "test-id-token", "a.b", "a.b.c.d", "!.e30.", "e30.bm90IGpzb24.", "e30.eyJleHAiOiJzb29uIn0."} {
+			_, err := ParseJWTClaims(token)
+			So(errors.Is(err, ErrInvalidJWT), ShouldBeTrue)
+		}
+	})
+}
+
+func TestVerifyJWT(t *testing.T) {
+	keys, err := ParseJWKS(testJWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+
+	Convey("Given a JSON web key set", t, func() {
+		Convey("The signing keys are parsed and other keys are ignored", func() {
+			So(keys, ShouldHaveLength, 2)
+			So(keys["rsa-key"], ShouldHaveSameTypeAs, &rsa.PublicKey{})
+			So(keys["ec-key"], ShouldHaveSameTypeAs, &ecdsa.PublicKey{})
+		})
+	})
+
+	Convey("Given tokens signed by a key in the set", t, func() {
+		for _, token := range []string{signTestJWT("RS256", "rsa-key", testClaims(expiresAt)), signTestJWT("ES256", "ec-key", testClaims(expiresAt))} {
+			claims, err := VerifyJWT(token, keys)
+			So(err, ShouldBeNil)
+			So(claims.Subject, ShouldEqual, "test-subject")
+		}
+	})
+
+	Convey("Given an expired token", t, func() {
+		token := signTestJWT("RS256", "rsa-key", testClaims(time.Now().Add(-time.Hour)))
+
+		Convey("The token is verified, leaving expiry to the caller", func() {
+			claims, err := VerifyJWT(token, keys)
+			So(err, ShouldBeNil)
+			So(claims.IsExpired(0), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a token with a tampered payload", t, func() {
+		token := signTestJWT("RS256", "rsa-key", testClaims(expiresAt))
+		forged := signTestJWT("RS256", "rsa-key", map[string]interface{}{"sub": "someone-else"})
+		parts, forgedParts := splitParts(token), splitParts(forged)
+		_, err := VerifyJWT(parts[0]+"."+forgedParts[1]+"."+parts[2], keys)
+		So(err, ShouldEqual, ErrInvalidJWTSignature)
+	})
+
+	Convey("Given a token signed by a key not in the set", t, func() {
+		_, err := VerifyJWT(signTestJWT("RS256", "other-key", testClaims(expiresAt)), keys)
+		So(errors.Is(err, ErrUnknownJWTKey), ShouldBeTrue)
+	})
+
+	Convey("Given a token without a key ID", t, func() {
+		token := signTestJWT("RS256", "", testClaims(expiresAt))
+
+		Convey("The only key of a single key set is used", func() {
+			_, err := VerifyJWT(token, KeySet{"rsa-key": keys["rsa-key"]})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("No key is guessed from a set of keys", func() {
+			_, err := VerifyJWT(token, keys)
+			So(errors.Is(err, ErrUnknownJWTKey), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given tokens using an algorithm which does not match the key", t, func() {
+		for _, algorithm := range []string{"none", "HS256", "ES256", "RS1"} {
+			token := signTestJWT("RS256", "rsa-key", testClaims(expiresAt))
+			parts := splitParts(token)
+			header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": "rsa-key"})
+			_, err := VerifyJWT(base64.RawURLEncoding.EncodeToString(header)+"."+parts[1]+"."+parts[2], keys)
+			So(errors.Is(err, ErrUnsupportedJWTAlgorithm), ShouldBeTrue)
+		}
+	})
+
+	Convey("Given tokens using an ECDSA algorithm for another curve than the key's", t, func() {
+		for _, algorithm := range []string{"ES384", "ES512"} {
+			token := signTestJWT("ES256", "ec-key", testClaims(expiresAt))
+			parts := splitParts(token)
+			header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": "ec-key"})
+			_, err := VerifyJWT(base64.RawURLEncoding.EncodeToString(header)+"."+parts[1]+"."+parts[2], keys)
+			So(errors.Is(err, ErrUnsupportedJWTAlgorithm), ShouldBeTrue)
+		}
+	})
+
+	Convey("Given invalid key sets", t, func() {
+		for _, jwks := range []string{`not json`, `{"keys":[{"kty":"RSA","kid":"k","n":"!","e":"AQAB"}]}`, `{"keys":[{"kty":"EC","kid":"k","crv":"P-192","x":"AQ","y":"AQ"}]}`} {
+			_, err := ParseJWKS([]byte(jwks))
+			So(errors.Is(err, ErrInvalidJWKS), ShouldBeTrue)
+		}
+	})
+}
+
+func TestClaimsIsExpired(t *testing.T) {
+	Convey("Given a token expiring in a minute", t, func() {
+		claims := Claims{ExpiresAt: time.Now().Add(time.Minute)}
+
+		Convey("It has not expired", func() {
+			So(claims.IsExpired(0), ShouldBeFalse)
+		})
+
+		Convey("It has expired when expiring within the leeway", func() {
+			So(claims.IsExpired(2*time.Minute), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a token which expired a minute ago", t, func() {
+		claims := Claims{ExpiresAt: time.Now().Add(-time.Minute)}
+
+		Convey("It has expired", func() {
+			So(claims.IsExpired(0), ShouldBeTrue)
+		})
+
+		Convey("A negative leeway allows for clock skew", func() {
+			So(claims.IsExpired(-2*time.Minute), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a token without an expiry", t, func() {
+		So(Claims{}.IsExpired(time.Hour), ShouldBeFalse)
+	})
+}
+
+func TestTokenCookieClaims(t *testing.T) {
+	keys, err := ParseJWKS(testJWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given a request with id_token and access_token cookies", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: idCookieKey, Value: signTestJWT("RS256", "rsa-key", map[string]interface{}{"email": "test@ons.gov.uk"})})
+		req.AddCookie(&http.Cookie{Name: florenceCookieKey, Value: signTestJWT("ES256", "ec-key", map[string]interface{}{"username": "test-user"})})
+
+		Convey("The claims of each cookie are returned", func() {
+			idClaims, err := GetIDTokenClaims(req)
+			So(err, ShouldBeNil)
+			So(idClaims.Email, ShouldEqual, "test@ons.gov.uk")
+
+			accessClaims, err := GetUserAuthTokenClaims(req)
+			So(err, ShouldBeNil)
+			So(accessClaims.Username, ShouldEqual, "test-user")
+		})
+
+		Convey("The verified claims of each cookie are returned", func() {
+			idClaims, err := GetVerifiedIDTokenClaims(req, keys)
+			So(err, ShouldBeNil)
+			So(idClaims.Email, ShouldEqual, "test@ons.gov.uk")
+
+			accessClaims, err := GetVerifiedUserAuthTokenClaims(req, keys)
+			So(err, ShouldBeNil)
+			So(accessClaims.Username, ShouldEqual, "test-user")
+		})
+	})
+
+	Convey("Given a request without token cookies", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		for _, get := range []func(*http.Request) (Claims, error){
+			GetIDTokenClaims,
+			GetUserAuthTokenClaims,
+			func(req *http.Request) (Claims, error) { return GetVerifiedIDTokenClaims(req, keys) },
+			func(req *http.Request) (Claims, error) { return GetVerifiedUserAuthTokenClaims(req, keys) },
+		} {
+			_, err := get(req)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func splitParts(token string) []string {
+	return strings.Split(token, ".")
+}
@@ -0,0 +1,119 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// LangHandler serves the language toggle, e.g. /set-lang?lang=cy&return_to=/census, by setting the lang cookie and
+// redirecting to a same-origin 'return_to' parameter or Referer, keeping its query string.
+//
+// When PathPrefix is set and the redirect path starts with a supported locale, as LocaleResolver.PathPrefix reads it, the
+// locale is replaced by the chosen one, or removed for the default, e.g. from /cy/census to /census. When Hosts is
+// configured and the request is to one of its hosts, the redirect is to the host of the chosen language, e.g. from
+// www.ons.gov.uk to cy.ons.gov.uk.
+type LangHandler struct {
+	// Domain is the domain of the lang cookie, which must cover every host in Hosts
+	Domain string
+	// Supported are the language tags which can be chosen, the first is the default
+	Supported []string
+	// PathPrefix is true when the first segment of the URL path can choose the locale, e.g. /cy/census
+	PathPrefix bool
+	// Hosts maps language tags to the host serving them, e.g. "cy" to "cy.ons.gov.uk"
+	Hosts map[string]string
+	// Scheme is the scheme of redirects to another host, "https" when empty
+	Scheme string
+	// DefaultReturnTo is where requests are redirected when there is no valid return_to parameter or Referer
+	DefaultReturnTo string
+}
+
+// NewLangHandler returns a LangHandler for the domain supporting English, the default, and Welsh, which is chosen by a
+// /cy path prefix as NewLocaleResolver does
+func NewLangHandler(domain string) *LangHandler {
+	return &LangHandler{
+		Domain:          domain,
+		Supported:       []string{LocaleEnglish, LocaleWelsh},
+		PathPrefix:      true,
+		DefaultReturnTo: "/",
+	}
+}
+
+func (h *LangHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	resolver := &LocaleResolver{Supported: h.Supported}
+	lang := req.FormValue("lang")
+	locale, ok := resolver.Match(lang)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported language %q", lang), http.StatusBadRequest)
+		return
+	}
+
+	// the user has asked for the language, so the cookie is set without consent to settings cookies
+	if err := TrySetLang(w, locale, h.Domain); err != nil {
+		getLogger().Error(req.Context(), "error setting language", err, logData{"lang": locale})
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	fallback := h.DefaultReturnTo
+	if fallback == "" {
+		fallback = "/"
+	}
+	returnTo := safeReturnTo(req, req.FormValue("return_to"), fallback)
+	if h.PathPrefix {
+		returnTo = localisePath(resolver, returnTo, locale)
+	}
+	http.Redirect(w, req, h.redirectURL(req, locale, returnTo), http.StatusSeeOther)
+}
+
+// localisePath replaces a supported locale at the start of the path of returnTo with the locale, or removes it when the
+// locale is the default, so that the path does not choose a different locale to the lang cookie
+func localisePath(resolver *LocaleResolver, returnTo, locale string) string {
+	path, rest := returnTo, ""
+	if i := strings.IndexAny(returnTo, "?#"); i >= 0 {
+		path, rest = returnTo[:i], returnTo[i:]
+	}
+
+	segment, remainder, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if _, ok := resolver.supported(segment); !ok {
+		return returnTo
+	}
+
+	if locale == resolver.defaultLocale() {
+		return "/" + remainder + rest
+	}
+	if remainder == "" && !strings.HasSuffix(path, "/") {
+		return "/" + locale + rest
+	}
+	return "/" + locale + "/" + remainder + rest
+}
+
+// redirectURL returns the absolute URL of returnTo on the host of the locale, when the request is to another of the
+// configured hosts, otherwise returnTo
+func (h *LangHandler) redirectURL(req *http.Request, locale, returnTo string) string {
+	target, ok := h.Hosts[locale]
+	if !ok {
+		return returnTo
+	}
+
+	host := requestHost(req)
+	if host == target {
+		return returnTo
+	}
+	for _, configured := range h.Hosts {
+		if host == configured {
+			scheme := h.Scheme
+			if scheme == "" {
+				scheme = "https"
+			}
+			return scheme + "://" + target + returnTo
+		}
+	}
+	return returnTo
+}
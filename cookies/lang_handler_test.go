@@ -0,0 +1,159 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLangHandler(t *testing.T) {
+	Convey("Given the language switch handler", t, func() {
+		handler := NewLangHandler("www.test.com")
+
+		Convey("When switching to a supported language", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set-lang?lang=CY&return_to="+url.QueryEscape("/census?page=2#maps"), http.NoBody))
+
+			Convey("The lang cookie is set and the user is returned, keeping the query string", func() {
+				expected := httptest.NewRecorder()
+				SetLang(expected, "cy", "www.test.com")
+				So(rec.Code, ShouldEqual, http.StatusSeeOther)
+				So(rec.Header().Get("Location"), ShouldEqual, "/census?page=2#maps")
+				So(rec.Header().Values("Set-Cookie"), ShouldResemble, expected.Header().Values("Set-Cookie"))
+			})
+		})
+
+		Convey("When switching language with a form post", func() {
+			req := httptest.NewRequest(http.MethodPost, "/set-lang", strings.NewReader(url.Values{"lang": {"en"}, "return_to": {"/census"}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The lang cookie is set and the user is returned", func() {
+				So(rec.Result().Cookies()[0].Value, ShouldEqual, "en")
+				So(rec.Header().Get("Location"), ShouldEqual, "/census")
+			})
+		})
+
+		Convey("When switching to an unsupported language", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set-lang?lang=fr&return_to=/census", http.NoBody))
+
+			Convey("The request is rejected without setting the cookie", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When return_to is not a same-origin relative URL", func() {
+			for _, returnTo := range []string{"https://evil.example.com/", "//evil.example.com", "/\\evil.example.com", "javascript:alert(1)", "census"} {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set-lang?lang=cy&return_to="+url.QueryEscape(returnTo), http.NoBody))
+				So(rec.Header().Get("Location"), ShouldEqual, "/")
+			}
+		})
+
+		Convey("When there is no return_to, but a same-origin Referer", func() {
+			req := httptest.NewRequest(http.MethodGet, "http://www.test.com/set-lang?lang=cy", http.NoBody)
+			req.Header.Set("Referer", "http://www.test.com/census?page=2")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The user is returned to the Referer", func() {
+				So(rec.Header().Get("Location"), ShouldEqual, "/census?page=2")
+			})
+		})
+
+		Convey("When return_to starts with a locale", func() {
+			tests := map[string]string{
+				"/set-lang?lang=en&return_to=" + url.QueryEscape("/cy/census?page=2#maps"): "/census?page=2#maps",
+				"/set-lang?lang=en&return_to=" + url.QueryEscape("/cy"):                    "/",
+				"/set-lang?lang=cy&return_to=" + url.QueryEscape("/en/census"):             "/cy/census",
+				"/set-lang?lang=cy&return_to=" + url.QueryEscape("/EN?page=2"):             "/cy?page=2",
+				"/set-lang?lang=cy&return_to=" + url.QueryEscape("/cy/census"):             "/cy/census",
+				"/set-lang?lang=cy&return_to=" + url.QueryEscape("/cymraeg/census"):        "/cymraeg/census",
+			}
+
+			Convey("The locale is replaced by the chosen one, or removed for the default", func() {
+				for target, location := range tests {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, http.NoBody))
+					So(rec.Header().Get("Location"), ShouldEqual, location)
+				}
+			})
+
+			Convey("The locale resolver chooses the locale which was switched to", func() {
+				resolver := NewLocaleResolver("www.test.com")
+				for _, lang := range []string{"en", "cy"} {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set-lang?lang="+lang+"&return_to="+url.QueryEscape("/cy/census"), http.NoBody))
+
+					// the user consents to settings cookies, so the middleware would rewrite a lang cookie not matching the path
+					req := httptest.NewRequest(http.MethodGet, rec.Header().Get("Location"), http.NoBody)
+					req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':true,'usage':false,'campaigns':false}"})
+					for _, c := range rec.Result().Cookies() {
+						req.AddCookie(c)
+					}
+					locale, _ := resolver.Resolve(req)
+					So(locale, ShouldEqual, lang)
+
+					var seen string
+					next := httptest.NewRecorder()
+					resolver.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+						seen, _ = LocaleFromContext(req.Context())
+					})).ServeHTTP(next, req)
+					So(seen, ShouldEqual, lang)
+					So(next.Header().Values("Set-Cookie"), ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("When the path does not choose the locale", func() {
+			handler.PathPrefix = false
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set-lang?lang=en&return_to=/cy/census", http.NoBody))
+
+			Convey("The return_to path is kept", func() {
+				So(rec.Header().Get("Location"), ShouldEqual, "/cy/census")
+			})
+		})
+
+		Convey("When the method is not GET or POST", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/set-lang?lang=cy", http.NoBody))
+			So(rec.Code, ShouldEqual, http.StatusMethodNotAllowed)
+		})
+	})
+
+	Convey("Given the language switch handler with hosts for each language", t, func() {
+		handler := NewLangHandler("ons.gov.uk")
+		handler.Hosts = map[string]string{"en": "www.ons.gov.uk", "cy": "cy.ons.gov.uk"}
+
+		tests := []struct {
+			host     string
+			lang     string
+			location string
+		}{
+			{host: "www.ons.gov.uk", lang: "cy", location: "https://cy.ons.gov.uk/census?page=2"},
+			{host: "cy.ons.gov.uk:443", lang: "en", location: "https://www.ons.gov.uk/census?page=2"},
+			{host: "cy.ons.gov.uk", lang: "cy", location: "/census?page=2"},
+			{host: "localhost:8080", lang: "cy", location: "/census?page=2"},
+		}
+
+		for _, tt := range tests {
+			Convey("When switching to "+tt.lang+" on "+tt.host, func() {
+				req := httptest.NewRequest(http.MethodGet, "/set-lang?lang="+tt.lang+"&return_to="+url.QueryEscape("/census?page=2"), http.NoBody)
+				req.Host = tt.host
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				So(rec.Header().Get("Location"), ShouldEqual, tt.location)
+				So(rec.Result().Cookies()[0].Domain, ShouldEqual, "ons.gov.uk")
+			})
+		}
+	})
+}
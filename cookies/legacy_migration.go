@@ -0,0 +1,100 @@
+package cookies
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// LegacyPolicyMigration is middleware which moves visitors who only have the deprecated cookies_policy and
+// cookies_preferences_set cookies onto the ons_cookie_policy and ons_cookie_message_displayed cookies, and expires
+// the deprecated cookies of every visitor. Migrated policies are passed to the ConsentRecorder set by
+// SetConsentRecorder.
+type LegacyPolicyMigration struct {
+	// Domain is the domain of the cookies written and expired
+	Domain string
+
+	migrations atomic.Int64
+}
+
+// NewLegacyPolicyMigration returns a LegacyPolicyMigration for the domain
+func NewLegacyPolicyMigration(domain string) *LegacyPolicyMigration {
+	return &LegacyPolicyMigration{Domain: domain}
+}
+
+// MigrateLegacyPolicy maps a deprecated Policy onto an ONSPolicy. Usage consent is kept, and categories the legacy
+// policy did not cover are not consented to.
+func MigrateLegacyPolicy(policy Policy) ONSPolicy {
+	return ONSPolicy{
+		Essential: true,
+		Usage:     policy.Usage,
+	}
+}
+
+// Migrations returns the number of visitors whose legacy consent was written to the ONS cookies since the middleware
+// was created
+func (m *LegacyPolicyMigration) Migrations() int64 {
+	return m.migrations.Load()
+}
+
+// Middleware migrates legacy-only visitors before calling next, which reads the migrated cookies from the request
+func (m *LegacyPolicyMigration) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, m.migrate(w, req))
+	})
+}
+
+// migrate expires the legacy cookies of a visitor, writing the ONS cookies unless the visitor already has them, and
+// returns the request carrying any ONS cookies written
+func (m *LegacyPolicyMigration) migrate(w http.ResponseWriter, req *http.Request) *http.Request {
+	legacyPolicy, policyErr := req.Cookie(cookiesPolicyCookieKey)
+	_, preferencesErr := req.Cookie(cookiesPreferencesSetCookieKey)
+	if policyErr != nil && preferencesErr != nil {
+		return req
+	}
+	// the ONS cookies record a more recent choice than the legacy cookies, so are never replaced
+	migrate := !hasONSCookies(req)
+
+	migrated := map[string]string{}
+	if policyErr == nil {
+		if policy, err := parsePolicy(legacyPolicy.Value); err != nil {
+			recordParseFailure(req.Context(), cookiesPolicyCookieKey)
+		} else if migrate {
+			// the legacy consent was not given to a versioned policy, so is written without a version or consent time
+			onsPolicy := MigrateLegacyPolicy(policy)
+			if getConsentRecorder() != nil {
+				// later changes are recorded under the same consent ID as the migration
+				onsPolicy.ConsentID = newConsentID()
+			}
+			setONSPolicy(w, onsPolicy, m.Domain)
+			migrated[onsCookiePolicyCookieKey] = encodeONSPolicy(onsPolicy)
+			if err := recordConsent(req, ONSPolicy{}, onsPolicy, Now()); err != nil {
+				getLogger().Error(req.Context(), "error recording migrated consent", err, nil)
+			}
+		}
+		expire(w, cookiesPolicyCookieKey, m.Domain, "/")
+	}
+	if preferencesErr == nil {
+		if migrate && getPreferencesIsSet(req) {
+			logSetError(req.Context(), onsCookiePreferencesSetCookieKey, TrySetONSPreferenceIsSet(w, m.Domain))
+			migrated[onsCookiePreferencesSetCookieKey] = "true"
+		}
+		expire(w, cookiesPreferencesSetCookieKey, m.Domain, "/")
+	}
+
+	if len(migrated) == 0 {
+		return req
+	}
+	m.migrations.Add(1)
+	getLogger().Info(req.Context(), "migrated legacy cookie policy", logData{"migrated": len(migrated)})
+
+	return withRequestCookies(req, migrated)
+}
+
+// hasONSCookies reports whether the request carries either of the ONS consent cookies
+func hasONSCookies(req *http.Request) bool {
+	if _, err := req.Cookie(onsCookiePolicyCookieKey); err == nil {
+		return true
+	}
+	_, err := req.Cookie(onsCookiePreferencesSetCookieKey)
+	return err == nil
+}
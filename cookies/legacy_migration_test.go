@@ -0,0 +1,158 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrateLegacyPolicy(t *testing.T) {
+	Convey("MigrateLegacyPolicy keeps usage consent and does not consent to new categories", t, func() {
+		So(MigrateLegacyPolicy(Policy{Essential: true, Usage: true}), ShouldResemble, ONSPolicy{Essential: true, Usage: true})
+		So(MigrateLegacyPolicy(Policy{}), ShouldResemble, ONSPolicy{Essential: true})
+	})
+}
+
+func TestLegacyPolicyMigration(t *testing.T) {
+	Convey("Given the legacy policy migration middleware", t, func() {
+		migration := NewLegacyPolicyMigration(testDomain)
+		var seen ONSPreferencesResponse
+		handler := migration.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			seen = GetONSCookiePreferences(req)
+		}))
+
+		Convey("When a visitor only has the legacy cookies", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "%7B%22essential%22%3Atrue%2C%22usage%22%3Atrue%7D"})
+			req.AddCookie(&http.Cookie{Name: cookiesPreferencesSetCookieKey, Value: "true"})
+			req.AddCookie(&http.Cookie{Name: "other", Value: "kept"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The ONS cookies are written and the legacy cookies expired", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 4)
+				So(written[onsCookiePolicyCookieKey].Value, ShouldEqual, "{'essential':true,'settings':false,'usage':true,'campaigns':false}")
+				So(written[onsCookiePreferencesSetCookieKey].Value, ShouldEqual, "true")
+				So(written[cookiesPolicyCookieKey].MaxAge, ShouldEqual, -1)
+				So(written[cookiesPreferencesSetCookieKey].MaxAge, ShouldEqual, -1)
+			})
+
+			Convey("The next handler reads the migrated preferences", func() {
+				So(seen, ShouldResemble, ONSPreferencesResponse{IsPreferenceSet: true, Policy: ONSPolicy{Essential: true, Usage: true}})
+			})
+
+			Convey("The migration is counted", func() {
+				So(migration.Migrations(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a visitor has a legacy policy but never set their preferences", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "%7B%22essential%22%3Atrue%2C%22usage%22%3Afalse%7D"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("Only the policy is migrated", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 2)
+				So(written, ShouldContainKey, onsCookiePolicyCookieKey)
+				So(seen.IsPreferenceSet, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a visitor has a corrupt legacy policy", func() {
+			metrics := usePrometheusMetrics()
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "corrupt"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The legacy policy is expired without writing an ONS policy", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 1)
+				So(written[cookiesPolicyCookieKey].MaxAge, ShouldEqual, -1)
+			})
+
+			Convey("It is counted as a parse failure rather than a migration", func() {
+				So(migration.Migrations(), ShouldEqual, 0)
+				So(metrics.counters["cookie_parse_failures_total"], ShouldResemble, map[string]float64{`cookie="cookies_policy"`: 1})
+			})
+		})
+
+		Convey("When a visitor already has the ONS cookies", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "%7B%22essential%22%3Atrue%2C%22usage%22%3Atrue%7D"})
+			req.AddCookie(&http.Cookie{Name: cookiesPreferencesSetCookieKey, Value: "true"})
+			req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The legacy cookies are expired without replacing the ONS cookies", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 2)
+				So(written[cookiesPolicyCookieKey].MaxAge, ShouldEqual, -1)
+				So(written[cookiesPreferencesSetCookieKey].MaxAge, ShouldEqual, -1)
+				So(migration.Migrations(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a visitor has no cookies", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", http.NoBody))
+
+			Convey("Nothing is migrated", func() {
+				So(rec.Result().Cookies(), ShouldBeEmpty)
+				So(migration.Migrations(), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a consent recorder", t, func() {
+		recorder := &MemoryConsentRecorder{}
+		SetConsentRecorder(recorder)
+		Reset(func() { SetConsentRecorder(nil) })
+
+		Convey("A migrated policy is recorded under the consent ID written to the cookie", func() {
+			var seen ONSPreferencesResponse
+			handler := NewLegacyPolicyMigration(testDomain).Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				seen = GetONSCookiePreferences(req)
+			}))
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("User-Agent", "test-agent")
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "%7B%22essential%22%3Atrue%2C%22usage%22%3Atrue%7D"})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			records := recorder.Records()
+			So(records, ShouldHaveLength, 1)
+			So(records[0].ConsentID, ShouldNotBeEmpty)
+			So(records[0].ConsentID, ShouldEqual, seen.Policy.ConsentID)
+			So(records[0].OldPolicy, ShouldResemble, ONSPolicy{})
+			So(records[0].NewPolicy, ShouldResemble, seen.Policy)
+			So(records[0].Timestamp.IsZero(), ShouldBeFalse)
+			So(records[0].UserAgent, ShouldEqual, "test-agent")
+		})
+	})
+
+	Convey("Given consent versioning is configured", t, func() {
+		SetConsentConfig(ConsentConfig{CurrentVersion: 1, MaxAge: time.Hour})
+		Reset(func() { SetConsentConfig(ConsentConfig{}) })
+
+		Convey("A migrated policy needs reconsent", func() {
+			var seen ONSPreferencesResponse
+			handler := NewLegacyPolicyMigration(testDomain).Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				seen = GetONSCookiePreferences(req)
+			}))
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "%7B%22essential%22%3Atrue%2C%22usage%22%3Atrue%7D"})
+			req.AddCookie(&http.Cookie{Name: cookiesPreferencesSetCookieKey, Value: "true"})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			So(seen.NeedsReconsent, ShouldBeTrue)
+			So(seen.Policy.Usage, ShouldBeTrue)
+		})
+	})
+}
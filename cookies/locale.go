@@ -1,14 +1,20 @@
 package cookies
 
 import (
+	"context"
 	"net/http"
 )
 
 // SetLang sets a cookie containing locale code
 func SetLang(w http.ResponseWriter, lang, domain string) {
+	logSetError(context.Background(), localeCookieKey, TrySetLang(w, lang, domain))
+}
+
+// TrySetLang sets a cookie containing locale code, returning an error if the cookie cannot be set
+func TrySetLang(w http.ResponseWriter, lang, domain string) error {
 	path := "/"
 	httpOnly := false
-	set(w, localeCookieKey, lang, domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
+	return trySet(w, localeCookieKey, lang, domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
 }
 
 // GetLang reads lang cookie and returns it's value
@@ -0,0 +1,285 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LocaleEnglish is the language tag of the English sites
+	LocaleEnglish = "en"
+
+	// LocaleWelsh is the language tag of the Welsh sites
+	LocaleWelsh = "cy"
+
+	// maxAcceptLanguages is the most Accept-Language entries considered
+	maxAcceptLanguages = 32
+)
+
+// ErrInvalidLanguageTag is returned when a language tag is not a well formed BCP 47 tag
+var ErrInvalidLanguageTag = errors.New("invalid language tag")
+
+// LocaleSource explains how a request's locale was chosen
+type LocaleSource string
+
+const (
+	// LocaleSourcePath is used when the locale is the first segment of the URL path, e.g. /cy/...
+	LocaleSourcePath LocaleSource = "path"
+
+	// LocaleSourceSubdomain is used when the locale is set by the subdomain, e.g. cy.ons.gov.uk
+	LocaleSourceSubdomain LocaleSource = "subdomain"
+
+	// LocaleSourceCookie is used when the locale is the value of the lang cookie
+	LocaleSourceCookie LocaleSource = "cookie"
+
+	// LocaleSourceAcceptLanguage is used when the locale is the user's preferred language from the Accept-Language header
+	LocaleSourceAcceptLanguage LocaleSource = "accept-language"
+
+	// LocaleSourceDefault is used when nothing in the request chooses a supported locale
+	LocaleSourceDefault LocaleSource = "default"
+)
+
+// LocaleResolver chooses the locale of a request from the supported locales. A locale in the URL path, then the
+// subdomain, overrides the lang cookie, which overrides the Accept-Language header.
+type LocaleResolver struct {
+	// Domain is the domain of the lang cookie
+	Domain string
+	// Supported are the language tags which can be chosen, the first is the default
+	Supported []string
+	// PathPrefix is true when the first segment of the URL path can choose the locale, e.g. /cy/census
+	PathPrefix bool
+	// Subdomains maps the first label of the host to the locale it chooses, e.g. "cy" for cy.ons.gov.uk
+	Subdomains map[string]string
+}
+
+// NewLocaleResolver returns a LocaleResolver for the domain supporting English, the default, and Welsh, which is
+// chosen by a /cy path prefix or the cy subdomain
+func NewLocaleResolver(domain string) *LocaleResolver {
+	return &LocaleResolver{
+		Domain:     domain,
+		Supported:  []string{LocaleEnglish, LocaleWelsh},
+		PathPrefix: true,
+		Subdomains: map[string]string{"cy": LocaleWelsh},
+	}
+}
+
+// Resolve returns the locale of the request, as a supported language tag, and how it was chosen
+func (r *LocaleResolver) Resolve(req *http.Request) (string, LocaleSource) {
+	if r.PathPrefix {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		if locale, ok := r.supported(segment); ok {
+			return locale, LocaleSourcePath
+		}
+	}
+
+	if host := requestHost(req); host != "" {
+		label, _, _ := strings.Cut(host, ".")
+		if locale, ok := r.Subdomains[label]; ok {
+			if locale, ok := r.Match(locale); ok {
+				return locale, LocaleSourceSubdomain
+			}
+		}
+	}
+
+	if lang, err := GetLang(req); err == nil {
+		if locale, ok := r.Match(lang); ok {
+			return locale, LocaleSourceCookie
+		}
+	}
+
+	for _, tag := range ParseAcceptLanguage(req.Header.Get("Accept-Language")) {
+		if tag == "*" {
+			break
+		}
+		if locale, ok := r.Match(tag); ok {
+			return locale, LocaleSourceAcceptLanguage
+		}
+	}
+
+	return r.defaultLocale(), LocaleSourceDefault
+}
+
+// Match returns the supported locale for a language tag, preferring an exact match, then one with the same primary
+// language, e.g. cy-GB matches cy
+func (r *LocaleResolver) Match(tag string) (string, bool) {
+	tag, err := NormaliseLanguageTag(tag)
+	if err != nil {
+		return "", false
+	}
+	if locale, ok := r.supported(tag); ok {
+		return locale, true
+	}
+
+	language, _, _ := strings.Cut(tag, "-")
+	for _, s := range r.Supported {
+		if supported, err := NormaliseLanguageTag(s); err == nil && strings.SplitN(supported, "-", 2)[0] == language {
+			return supported, true
+		}
+	}
+	return "", false
+}
+
+// supported returns the supported locale which is exactly the tag
+func (r *LocaleResolver) supported(tag string) (string, bool) {
+	tag, err := NormaliseLanguageTag(tag)
+	if err != nil {
+		return "", false
+	}
+	for _, s := range r.Supported {
+		if supported, err := NormaliseLanguageTag(s); err == nil && supported == tag {
+			return supported, true
+		}
+	}
+	return "", false
+}
+
+func (r *LocaleResolver) defaultLocale() string {
+	if len(r.Supported) == 0 {
+		return LocaleEnglish
+	}
+	locale, err := NormaliseLanguageTag(r.Supported[0])
+	if err != nil {
+		return LocaleEnglish
+	}
+	return locale
+}
+
+// Middleware puts the locale of the request in its context, see LocaleFromContext, and refreshes the lang cookie
+// when it holds a different locale, if the user's consent allows the cookie, before calling next. The default locale
+// is not written to the cookie.
+func (r *LocaleResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		locale, source := r.Resolve(req)
+
+		if source != LocaleSourceDefault && CookieAllowed(req, localeCookieKey) {
+			if lang, err := GetLang(req); err != nil || lang != locale {
+				logSetError(req.Context(), localeCookieKey, TrySetLang(w, locale, r.Domain))
+			}
+		}
+
+		next.ServeHTTP(w, req.WithContext(WithLocale(req.Context(), locale)))
+	})
+}
+
+// localeContextKey is the request context key of the locale
+type localeContextKey struct{}
+
+// WithLocale returns a copy of the context holding the locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, locale)
+}
+
+// LocaleFromContext returns the locale put in the context by LocaleResolver.Middleware or WithLocale
+func LocaleFromContext(ctx context.Context) (string, bool) {
+	locale, ok := ctx.Value(localeContextKey{}).(string)
+	return locale, ok
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language header, normalised and ordered by their
+// q-values. Tags with a q-value of 0 or an invalid q-value, and malformed tags, are left out, and parameters other than q
+// are ignored. The "*" wildcard is kept.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for i, entry := range strings.Split(header, ",") {
+		if i == maxAcceptLanguages {
+			break
+		}
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		tag = strings.TrimSpace(tag)
+		q, ok := acceptLanguageQ(params)
+		if !ok || q == 0 {
+			continue
+		}
+
+		if tag != "*" {
+			var err error
+			if tag, err = NormaliseLanguageTag(tag); err != nil {
+				continue
+			}
+		}
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// acceptLanguageQ returns the q-value of the parameters of an Accept-Language entry, 1 when there is none, and whether
+// it is valid. Other parameters are ignored.
+func acceptLanguageQ(params string) (float64, bool) {
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+		var err error
+		// NaN fails both comparisons
+		if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || !(q >= 0 && q <= 1) {
+			return 0, false
+		}
+	}
+	return q, true
+}
+
+// NormaliseLanguageTag returns the BCP 47 tag in its canonical case, e.g. en_gb becomes en-GB and zh-hant becomes
+// zh-Hant, or ErrInvalidLanguageTag when it is not well formed
+func NormaliseLanguageTag(tag string) (string, error) {
+	subtags := strings.Split(strings.ReplaceAll(tag, "_", "-"), "-")
+
+	language := subtags[0]
+	if len(language) < 2 || len(language) > 8 || !isAlpha(language) {
+		return "", ErrInvalidLanguageTag
+	}
+	subtags[0] = strings.ToLower(language)
+
+	for i, subtag := range subtags[1:] {
+		if subtag == "" || len(subtag) > 8 || !isAlphaNumericString(subtag) {
+			return "", ErrInvalidLanguageTag
+		}
+		switch {
+		case len(subtag) == 4 && isAlpha(subtag) && i == 0:
+			// script
+			subtags[i+1] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 && isAlpha(subtag):
+			// region
+			subtags[i+1] = strings.ToUpper(subtag)
+		default:
+			subtags[i+1] = strings.ToLower(subtag)
+		}
+	}
+
+	return strings.Join(subtags, "-"), nil
+}
+
+func isAlpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphaNumericString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isAlphaNumeric(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// withSettingsConsent adds the cookies of a user who has consented to settings cookies
+func withSettingsConsent(req *http.Request) *http.Request {
+	req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':true,'usage':false,'campaigns':false}"})
+	req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+	return req
+}
+
+func TestLocaleResolverResolve(t *testing.T) {
+	resolver := NewLocaleResolver("www.test.com")
+
+	Convey("Given requests choosing a locale in different ways", t, func() {
+		tests := []struct {
+			name           string
+			target         string
+			lang           string
+			acceptLanguage string
+			locale         string
+			source         LocaleSource
+		}{
+			{name: "nothing", target: "http://www.test.com/", locale: "en", source: LocaleSourceDefault},
+			{name: "a path prefix", target: "http://www.test.com/cy/census", lang: "en", acceptLanguage: "en", locale: "cy", source: LocaleSourcePath},
+			{name: "a path prefix alone", target: "http://www.test.com/CY", locale: "cy", source: LocaleSourcePath},
+			{name: "a path which only starts like a locale", target: "http://www.test.com/cymraeg", locale: "en", source: LocaleSourceDefault},
+			{name: "a subdomain", target: "http://cy.test.com:8080/census", lang: "en", acceptLanguage: "en", locale: "cy", source: LocaleSourceSubdomain},
+			{name: "a cookie", target: "http://www.test.com/census", lang: "cy", acceptLanguage: "en", locale: "cy", source: LocaleSourceCookie},
+			{name: "a cookie with a region", target: "http://www.test.com/census", lang: "cy_gb", locale: "cy", source: LocaleSourceCookie},
+			{name: "an unsupported cookie", target: "http://www.test.com/census", lang: "fr", acceptLanguage: "cy", locale: "cy", source: LocaleSourceAcceptLanguage},
+			{name: "accept language q-values", target: "http://www.test.com/", acceptLanguage: "fr;q=0.9, en;q=0.5, cy-GB;q=0.8", locale: "cy", source: LocaleSourceAcceptLanguage},
+			{name: "accept language without a supported locale", target: "http://www.test.com/", acceptLanguage: "fr, de;q=0.5", locale: "en", source: LocaleSourceDefault},
+			{name: "accept language with a wildcard", target: "http://www.test.com/", acceptLanguage: "fr, *;q=0.9, cy;q=0.5", locale: "en", source: LocaleSourceDefault},
+		}
+
+		for _, tt := range tests {
+			Convey("When the locale is chosen by "+tt.name, func() {
+				req := httptest.NewRequest(http.MethodGet, tt.target, http.NoBody)
+				if tt.lang != "" {
+					req.AddCookie(&http.Cookie{Name: localeCookieKey, Value: tt.lang})
+				}
+				if tt.acceptLanguage != "" {
+					req.Header.Set("Accept-Language", tt.acceptLanguage)
+				}
+
+				locale, source := resolver.Resolve(req)
+				So(locale, ShouldEqual, tt.locale)
+				So(source, ShouldEqual, tt.source)
+			})
+		}
+	})
+
+	Convey("Given a resolver without path prefixes or subdomains", t, func() {
+		resolver := &LocaleResolver{Supported: []string{"cy", "en-GB"}}
+
+		Convey("The first supported locale is the default and overrides are ignored", func() {
+			locale, source := resolver.Resolve(httptest.NewRequest(http.MethodGet, "http://en.test.com/en-gb/", http.NoBody))
+			So(locale, ShouldEqual, "cy")
+			So(source, ShouldEqual, LocaleSourceDefault)
+		})
+
+		Convey("A tag with the same language matches a supported locale with a region", func() {
+			locale, ok := resolver.Match("EN")
+			So(ok, ShouldBeTrue)
+			So(locale, ShouldEqual, "en-GB")
+		})
+	})
+}
+
+func TestLocaleResolverMiddleware(t *testing.T) {
+	Convey("Given the locale middleware", t, func() {
+		resolver := NewLocaleResolver("www.test.com")
+		var locale string
+		var ok bool
+		handler := resolver.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			locale, ok = LocaleFromContext(req.Context())
+		}))
+
+		Convey("When a consenting user's locale is overridden by the URL", func() {
+			req := withSettingsConsent(httptest.NewRequest(http.MethodGet, "/cy/census", http.NoBody))
+			req.AddCookie(&http.Cookie{Name: localeCookieKey, Value: "en"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The locale is in the context and the cookie is refreshed", func() {
+				expected := httptest.NewRecorder()
+				SetLang(expected, "cy", "www.test.com")
+				So(ok, ShouldBeTrue)
+				So(locale, ShouldEqual, "cy")
+				So(rec.Header().Values("Set-Cookie"), ShouldResemble, expected.Header().Values("Set-Cookie"))
+			})
+		})
+
+		Convey("When the cookie already holds the locale", func() {
+			req := withSettingsConsent(httptest.NewRequest(http.MethodGet, "/cy/census", http.NoBody))
+			req.AddCookie(&http.Cookie{Name: localeCookieKey, Value: "cy"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The cookie is not written", func() {
+				So(locale, ShouldEqual, "cy")
+				So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the cookie holds a locale which is not normalised", func() {
+			req := withSettingsConsent(httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+			req.AddCookie(&http.Cookie{Name: localeCookieKey, Value: "CY"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The cookie is refreshed with the normalised locale", func() {
+				So(rec.Result().Cookies()[0].Value, ShouldEqual, "cy")
+			})
+		})
+
+		Convey("When the user has not consented to settings cookies", func() {
+			req := httptest.NewRequest(http.MethodGet, "/cy/census", http.NoBody)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The locale is in the context but the cookie is not written", func() {
+				So(locale, ShouldEqual, "cy")
+				So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When nothing chooses the locale", func() {
+			req := withSettingsConsent(httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The default locale is in the context but not written to the cookie", func() {
+				So(locale, ShouldEqual, "en")
+				So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a context without a locale", t, func() {
+		_, ok := LocaleFromContext(context.Background())
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	Convey("Given Accept-Language headers", t, func() {
+		tests := map[string][]string{
+			"":                                  {},
+			"cy":                                {"cy"},
+			"en-gb,en;q=0.8,cy;q=0.9":           {"en-GB", "cy", "en"},
+			"cy;q=0, en":                        {"en"},
+			"fr;q=abc, de;q=2, en;level=1, cy":  {"en", "cy"},
+			"en;level=1;q=0.5, cy;q=0.8":        {"cy", "en"},
+			"fr;q=NaN, de;q=-0, cy;Q=1;q=0.1":   {"cy"},
+			"en-US , *;q=0.1":                   {"en-US", "*"},
+			"zh-hant-tw;q=0.5, not a tag, 12-a": {"zh-Hant-TW"},
+		}
+
+		for header, expected := range tests {
+			So(ParseAcceptLanguage(header), ShouldResemble, expected)
+		}
+	})
+}
+
+func TestNormaliseLanguageTag(t *testing.T) {
+	Convey("Given well formed language tags", t, func() {
+		tests := map[string]string{
+			"en":         "en",
+			"CY":         "cy",
+			"en_gb":      "en-GB",
+			"sr-latn-rs": "sr-Latn-RS",
+			"es-419":     "es-419",
+			"de-CH-1996": "de-CH-1996",
+		}
+
+		for tag, expected := range tests {
+			normalised, err := NormaliseLanguageTag(tag)
+			So(err, ShouldBeNil)
+			So(normalised, ShouldEqual, expected)
+		}
+	})
+
+	Convey("Given malformed language tags", t, func() {
+		for _, tag := range []string{"", "e", "en-", "en--gb", "e1", "en-toolongsubtag", "en gb", "cy;q=1"} {
+			_, err := NormaliseLanguageTag(tag)
+			So(errors.Is(err, ErrInvalidLanguageTag), ShouldBeTrue)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package cookies
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -39,3 +40,27 @@ func TestUnitLocale(t *testing.T) {
 		So(cookie.SameSite, ShouldEqual, http.SameSiteLaxMode)
 	})
 }
+
+func TestTrySetLang(t *testing.T) {
+	Convey("Given a valid locale", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetLang(rec, "cy", "www.test.com")
+
+		Convey("The cookie is set as SetLang sets it", func() {
+			legacy := httptest.NewRecorder()
+			SetLang(legacy, "cy", "www.test.com")
+			So(err, ShouldBeNil)
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, legacy.Header().Get("Set-Cookie"))
+		})
+	})
+
+	Convey("Given an invalid domain", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetLang(rec, "cy", "www.test.com:8080")
+
+		Convey("An error is returned and no cookie is set", func() {
+			So(errors.Is(err, ErrInvalidCookieDomain), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
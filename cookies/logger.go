@@ -0,0 +1,107 @@
+package cookies
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Logger receives the events logged by this library, see SetLogger
+type Logger interface {
+	Info(ctx context.Context, event string, data map[string]interface{})
+	Error(ctx context.Context, event string, err error, data map[string]interface{})
+}
+
+// logData is the data logged with an event
+type logData = map[string]interface{}
+
+var (
+	loggerMutex sync.RWMutex
+	logger      Logger = LogGoLogger{}
+)
+
+// SetLogger sets the logger used by this library, or restores the default LogGoLogger when nil. It is intended to be
+// called once when a service starts.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = LogGoLogger{}
+	}
+
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	logger = l
+}
+
+func getLogger() Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return logger
+}
+
+// LogGoLogger logs events using github.com/ONSdigital/log.go, and is the default Logger
+type LogGoLogger struct{}
+
+// Info logs an event at info level
+func (LogGoLogger) Info(ctx context.Context, event string, data map[string]interface{}) {
+	if data == nil {
+		log.Info(ctx, event)
+		return
+	}
+	log.Info(ctx, event, log.Data(data))
+}
+
+// Error logs an event at error level
+func (LogGoLogger) Error(ctx context.Context, event string, err error, data map[string]interface{}) {
+	if data == nil {
+		log.Error(ctx, event, err)
+		return
+	}
+	log.Error(ctx, event, err, log.Data(data))
+}
+
+// NopLogger discards every event
+type NopLogger struct{}
+
+// Info discards the event
+func (NopLogger) Info(context.Context, string, map[string]interface{}) {}
+
+// Error discards the event
+func (NopLogger) Error(context.Context, string, error, map[string]interface{}) {}
+
+// SlogLogger logs events to a *slog.Logger, so that services can use their own slog handlers
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger which logs to l
+func NewSlogLogger(l *slog.Logger) SlogLogger {
+	return SlogLogger{Logger: l}
+}
+
+// Info logs an event at info level, with the data as attributes
+func (s SlogLogger) Info(ctx context.Context, event string, data map[string]interface{}) {
+	s.Logger.InfoContext(ctx, event, slogAttrs(data)...)
+}
+
+// Error logs an event at error level, with the data and an 'error' attribute
+func (s SlogLogger) Error(ctx context.Context, event string, err error, data map[string]interface{}) {
+	s.Logger.ErrorContext(ctx, event, append(slogAttrs(data), slog.Any("error", err))...)
+}
+
+// slogAttrs returns the data as slog attributes, ordered by key
+func slogAttrs(data map[string]interface{}) []any {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]any, 0, len(keys)+1)
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, data[k]))
+	}
+	return attrs
+}
@@ -0,0 +1,105 @@
+package cookies
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loggedEvent is an event received by a testLogger
+type loggedEvent struct {
+	Level string
+	Event string
+	Err   error
+	Data  map[string]interface{}
+}
+
+// testLogger is a Logger which keeps every event logged
+type testLogger struct {
+	mutex  sync.Mutex
+	events []loggedEvent
+}
+
+func (l *testLogger) Info(_ context.Context, event string, data map[string]interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.events = append(l.events, loggedEvent{Level: "info", Event: event, Data: data})
+}
+
+func (l *testLogger) Error(_ context.Context, event string, err error, data map[string]interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.events = append(l.events, loggedEvent{Level: "error", Event: event, Err: err, Data: data})
+}
+
+func TestSetLogger(t *testing.T) {
+	Convey("Given a logger is set", t, func() {
+		l := &testLogger{}
+		SetLogger(l)
+		Reset(func() { SetLogger(nil) })
+
+		Convey("Errors from the fire-and-forget setters are logged to it", func() {
+			SetLang(httptest.NewRecorder(), "cy", "a..b")
+			So(l.events, ShouldHaveLength, 1)
+			So(l.events[0].Level, ShouldEqual, "error")
+			So(l.events[0].Event, ShouldEqual, "cookie not set")
+			So(errors.Is(l.events[0].Err, ErrInvalidCookieDomain), ShouldBeTrue)
+			So(l.events[0].Data, ShouldResemble, map[string]interface{}{"name": localeCookieKey})
+		})
+
+		Convey("A/b test events are logged to it", func() {
+			GetABTestCookieAspect(httptest.NewRequest("GET", "/", http.NoBody), testAspectID)
+			So(l.events, ShouldResemble, []loggedEvent{{Level: "info", Event: "a/b test cookie not found", Data: map[string]interface{}{"aspectID": testAspectID}}})
+		})
+	})
+
+	Convey("Setting a nil logger restores the default", t, func() {
+		SetLogger(NopLogger{})
+		SetLogger(nil)
+		So(getLogger(), ShouldResemble, LogGoLogger{})
+	})
+}
+
+func TestSlogLogger(t *testing.T) {
+	Convey("Given a SlogLogger writing JSON", t, func() {
+		var buf bytes.Buffer
+		l := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+		Convey("Info events are logged with their data", func() {
+			l.Info(context.Background(), "migrated legacy cookie policy", map[string]interface{}{"migrated": 2})
+
+			var entry map[string]interface{}
+			So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+			So(entry["level"], ShouldEqual, "INFO")
+			So(entry["msg"], ShouldEqual, "migrated legacy cookie policy")
+			So(entry["migrated"], ShouldEqual, 2)
+		})
+
+		Convey("Error events are logged with the error", func() {
+			l.Error(context.Background(), "cookie not set", errors.New("invalid cookie"), map[string]interface{}{"name": "lang"})
+
+			var entry map[string]interface{}
+			So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+			So(entry["level"], ShouldEqual, "ERROR")
+			So(entry["error"], ShouldEqual, "invalid cookie")
+			So(entry["name"], ShouldEqual, "lang")
+		})
+	})
+}
+
+func TestNopLogger(t *testing.T) {
+	Convey("NopLogger discards events", t, func() {
+		SetLogger(NopLogger{})
+		Reset(func() { SetLogger(nil) })
+
+		So(func() { SetLang(httptest.NewRecorder(), "cy", "a..b") }, ShouldNotPanic)
+	})
+}
@@ -0,0 +1,59 @@
+package cookies
+
+import (
+	"sync"
+)
+
+// MetricsCollector receives the events counted by this library, see SetMetricsCollector. Implementations must be safe
+// for concurrent use.
+type MetricsCollector interface {
+	// CookieParseFailure is called when a cookie could not be read, in full or in part
+	CookieParseFailure(cookie string)
+	// ConsentChoice is called for each category of the consent a user gives, when SetONSConsent writes it
+	ConsentChoice(category string, value bool)
+	// ConsentFallback is called when a consent cookie is replaced, in full or in part, by the default policy, with the
+	// reason, e.g. "not recorded" or "corrupt"
+	ConsentFallback(cookie, reason string)
+	// ABTestAssignment is called when Handler assigns a user to a variant
+	ABTestAssignment(aspectID string, variant ABTestVariant)
+	// LegacyCookieSeen is called when a request has the deprecated cookies_policy cookie
+	LegacyCookieSeen()
+}
+
+var (
+	metricsCollectorMutex sync.RWMutex
+	metricsCollector      MetricsCollector
+)
+
+// SetMetricsCollector sets the collector of this library's metrics, such as a PrometheusMetrics, or disables
+// collection when nil. It is intended to be called once when a service starts.
+func SetMetricsCollector(collector MetricsCollector) {
+	metricsCollectorMutex.Lock()
+	defer metricsCollectorMutex.Unlock()
+	metricsCollector = collector
+}
+
+// getMetricsCollector returns the collector set by SetMetricsCollector, and false when there is none
+func getMetricsCollector() (MetricsCollector, bool) {
+	metricsCollectorMutex.RLock()
+	defer metricsCollectorMutex.RUnlock()
+	return metricsCollector, metricsCollector != nil
+}
+
+// recordConsentChoices counts the value of each category of the consent a user gave
+func recordConsentChoices(policy ONSPolicy) {
+	collector, ok := getMetricsCollector()
+	if !ok {
+		return
+	}
+	for category, field := range onsPolicyFields {
+		collector.ConsentChoice(category, *field(&policy))
+	}
+}
+
+// recordLegacyCookieSeen counts a request with the deprecated cookies_policy cookie
+func recordLegacyCookieSeen() {
+	if collector, ok := getMetricsCollector(); ok {
+		collector.LegacyCookieSeen()
+	}
+}
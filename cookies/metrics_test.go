@@ -0,0 +1,123 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// usePrometheusMetrics sets a new PrometheusMetrics as the metrics collector for the duration of a test
+func usePrometheusMetrics() *PrometheusMetrics {
+	metrics := NewPrometheusMetrics()
+	SetMetricsCollector(metrics)
+	Reset(func() { SetMetricsCollector(nil) })
+	return metrics
+}
+
+func TestMetricsCollector(t *testing.T) {
+	Convey("Given a metrics collector", t, func() {
+		metrics := usePrometheusMetrics()
+
+		Convey("Each category of the consent a user gives is counted", func() {
+			SetONSConsent(httptest.NewRecorder(), httptest.NewRequest("POST", "/", http.NoBody), ONSPolicy{Essential: true, Usage: true}, testDomain)
+
+			So(metrics.counters["consent_choice_total"], ShouldResemble, map[string]float64{
+				`category="essential",value="true"`:  1,
+				`category="settings",value="false"`:  1,
+				`category="usage",value="true"`:      1,
+				`category="campaigns",value="false"`: 1,
+			})
+		})
+
+		Convey("Reading a valid ons_cookie_policy is not counted as a choice", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Cookie", onsCookiePolicyCookieKey+"={'essential':true,'settings':false,'usage':true,'campaigns':false}")
+			GetONSCookiePreferences(req)
+			GetONSCookiePreferences(req)
+
+			So(metrics.counters["consent_choice_total"], ShouldBeEmpty)
+			So(metrics.counters["consent_fallback_total"], ShouldBeEmpty)
+		})
+
+		Convey("A corrupt ons_cookie_policy is counted as a parse failure and a fallback", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':tr"})
+			GetONSCookiePreferences(req)
+
+			So(metrics.counters["cookie_parse_failures_total"], ShouldResemble, map[string]float64{`cookie="ons_cookie_policy"`: 1})
+			So(metrics.counters["consent_fallback_total"], ShouldResemble, map[string]float64{`cookie="ons_cookie_policy",reason="corrupt"`: 1})
+		})
+
+		Convey("A missing ons_cookie_policy is counted as a fallback", func() {
+			GetONSCookiePreferences(httptest.NewRequest("GET", "/", http.NoBody))
+
+			So(metrics.counters["consent_fallback_total"], ShouldResemble, map[string]float64{`cookie="ons_cookie_policy",reason="not recorded"`: 1})
+		})
+
+		Convey("Handler counts a corrupt ons_cookie_policy once, although the consent is read more than once", func() {
+			handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':tr"})
+			Handler(true, handler, handler, 0, testAspectID, testDomain, "exit-new").ServeHTTP(httptest.NewRecorder(), req)
+
+			So(metrics.counters["cookie_parse_failures_total"], ShouldResemble, map[string]float64{`cookie="ons_cookie_policy"`: 1})
+			So(metrics.counters["consent_fallback_total"], ShouldResemble, map[string]float64{`cookie="ons_cookie_policy",reason="corrupt"`: 1})
+		})
+
+		Convey("A request caching its consent counts each ons_cookie_policy value once", func() {
+			req := withONSPolicyCache(httptest.NewRequest("GET", "/", http.NoBody))
+			GetONSCookiePreferences(req)
+			GetONSCookiePreferences(req)
+			So(metrics.counters["consent_fallback_total"], ShouldResemble, map[string]float64{`cookie="ons_cookie_policy",reason="not recorded"`: 1})
+
+			corrupt := withRequestCookies(req, map[string]string{onsCookiePolicyCookieKey: "{'essential':tr"})
+			So(withONSPolicyCache(corrupt), ShouldEqual, corrupt)
+			GetONSCookiePreferences(corrupt)
+			GetONSCookiePreferences(corrupt)
+			So(metrics.counters["consent_fallback_total"], ShouldResemble, map[string]float64{
+				`cookie="ons_cookie_policy",reason="not recorded"`: 1,
+				`cookie="ons_cookie_policy",reason="corrupt"`:      1,
+			})
+		})
+
+		Convey("A missing cookies_policy is not counted as a fallback", func() {
+			GetCookiePreferences(httptest.NewRequest("GET", "/", http.NoBody))
+
+			So(metrics.counters["consent_fallback_total"], ShouldBeEmpty)
+		})
+
+		Convey("A cookies_policy cookie is counted as a legacy cookie, and as a parse failure when corrupt", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "corrupt"})
+			GetCookiePreferences(req)
+
+			So(metrics.counters["legacy_cookie_seen_total"], ShouldResemble, map[string]float64{"": 1})
+			So(metrics.counters["cookie_parse_failures_total"], ShouldResemble, map[string]float64{`cookie="cookies_policy"`: 1})
+		})
+
+		Convey("A corrupt ab_test cookie is counted as a parse failure", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: aBTestKey, Value: "corrupt"})
+			GetABTestCookieAspect(req, testAspectID)
+
+			So(metrics.counters["cookie_parse_failures_total"], ShouldResemble, map[string]float64{`cookie="ab_test"`: 1})
+		})
+
+		Convey("Handler counts the assignment of a user to a variant", func() {
+			handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+			Handler(true, handler, handler, 0, testAspectID, testDomain, "exit-new").ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", http.NoBody))
+
+			So(metrics.counters["ab_assignments_total"], ShouldResemble, map[string]float64{`aspect="` + testAspectID + `",variant="old"`: 1})
+		})
+	})
+
+	Convey("Given no metrics collector", t, func() {
+		Convey("Cookies are read without counting", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "corrupt"})
+			So(func() { GetCookiePreferences(req) }, ShouldNotPanic)
+		})
+	})
+}
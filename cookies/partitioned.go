@@ -0,0 +1,72 @@
+package cookies
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrInvalidPartitionedCookie is returned when a cookie cannot be partitioned
+var ErrInvalidPartitionedCookie = errors.New("invalid partitioned cookie")
+
+var (
+	partitionedMutex sync.RWMutex
+	partitioned      = map[string]bool{}
+)
+
+// SetPartitioned configures whether the named cookie is written with the Partitioned attribute (CHIPS), so that it
+// can be used by pages embedded in third-party iframes. Partitioned cookies are written with SameSite=None and Secure,
+// so cookies whose definition requires SameSite=Strict cannot be partitioned.
+func SetPartitioned(name string, isPartitioned bool) error {
+	d, ok := registry[name]
+	if !ok {
+		return fmt.Errorf("%w: %q is not written by this library", ErrInvalidPartitionedCookie, name)
+	}
+	if isPartitioned && d.SameSite == http.SameSiteStrictMode {
+		return fmt.Errorf("%w: %q requires SameSite=Strict", ErrInvalidPartitionedCookie, name)
+	}
+
+	partitionedMutex.Lock()
+	defer partitionedMutex.Unlock()
+	if isPartitioned {
+		partitioned[name] = true
+	} else {
+		delete(partitioned, name)
+	}
+	return nil
+}
+
+// isPartitioned returns true when the cookie, or the unprefixed cookie, has been configured by SetPartitioned
+func isPartitioned(name string) bool {
+	_, unprefixed := splitPrefix(name)
+
+	partitionedMutex.RLock()
+	defer partitionedMutex.RUnlock()
+	return partitioned[unprefixed]
+}
+
+// partition adds the Partitioned attribute, and the attributes it requires, to a cookie configured by SetPartitioned
+func partition(c *http.Cookie) {
+	if !isPartitioned(c.Name) {
+		return
+	}
+
+	c.Partitioned = true
+	c.Secure = true
+	c.SameSite = http.SameSiteNoneMode
+}
+
+// validatePartitioned returns an error when a partitioned cookie is missing the attributes it requires
+func validatePartitioned(c *http.Cookie) error {
+	if !c.Partitioned {
+		return nil
+	}
+	if !c.Secure {
+		return fmt.Errorf("%w: %q must be secure", ErrInvalidPartitionedCookie, c.Name)
+	}
+	if c.SameSite != http.SameSiteNoneMode {
+		return fmt.Errorf("%w: %q must have SameSite=None, not %s", ErrInvalidPartitionedCookie, c.Name, sameSiteString(c.SameSite))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetPartitioned(t *testing.T) {
+	Convey("Given a cookie which is not written by this library", t, func() {
+		err := SetPartitioned("unknown", true)
+
+		Convey("It cannot be partitioned", func() {
+			So(errors.Is(err, ErrInvalidPartitionedCookie), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a cookie which requires SameSite=Strict", t, func() {
+		err := SetPartitioned(florenceCookieKey, true)
+
+		Convey("It cannot be partitioned", func() {
+			So(errors.Is(err, ErrInvalidPartitionedCookie), ShouldBeTrue)
+			So(isPartitioned(florenceCookieKey), ShouldBeFalse)
+		})
+
+		Convey("But it can be configured as not partitioned", func() {
+			So(SetPartitioned(florenceCookieKey, false), ShouldBeNil)
+		})
+	})
+
+	Convey("Given the lang cookie is partitioned", t, func() {
+		So(SetPartitioned(localeCookieKey, true), ShouldBeNil)
+		Reset(func() { _ = SetPartitioned(localeCookieKey, false) })
+
+		Convey("SetLang writes it with the Partitioned attribute, SameSite=None and Secure", func() {
+			rec := httptest.NewRecorder()
+			SetLang(rec, "cy", "www.test.com")
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, "lang=cy; Path=/; Domain=www.test.com; Max-Age=31622400; Secure; SameSite=None; Partitioned")
+		})
+
+		Convey("It is expired with the Partitioned attribute", func() {
+			rec := httptest.NewRecorder()
+			expire(rec, localeCookieKey, "www.test.com", "/")
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, "lang=; Path=/; Domain=www.test.com; Max-Age=0; Secure; SameSite=None; Partitioned")
+		})
+
+		Convey("Lookup returns a partitioned definition, which the written cookie meets", func() {
+			rec := httptest.NewRecorder()
+			SetLang(rec, "cy", "www.test.com")
+			d, ok := Lookup(localeCookieKey)
+			So(ok, ShouldBeTrue)
+			So(d.Partitioned, ShouldBeTrue)
+			So(d.SameSite, ShouldEqual, http.SameSiteNoneMode)
+			So(d.Check(rec.Result().Cookies()[0]), ShouldBeEmpty)
+		})
+
+		Convey("Other cookies are not partitioned", func() {
+			rec := httptest.NewRecorder()
+			SetCollection(rec, "collection-id", "www.test.com")
+			So(rec.Result().Cookies()[0].Partitioned, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given the ons_cookie_policy cookie is partitioned", t, func() {
+		So(SetPartitioned(onsCookiePolicyCookieKey, true), ShouldBeNil)
+		Reset(func() { _ = SetPartitioned(onsCookiePolicyCookieKey, false) })
+
+		Convey("SetONSPolicy writes the unencoded value with the Partitioned attribute", func() {
+			rec := httptest.NewRecorder()
+			SetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true}, "www.test.com")
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, "ons_cookie_policy={'essential':true,'settings':false,'usage':true,'campaigns':false}; Path=/; Domain=www.test.com; Max-Age=31622400; Secure; SameSite=None; Partitioned")
+		})
+	})
+}
+
+func TestValidatePartitioned(t *testing.T) {
+	Convey("Partitioned cookies must be secure and have SameSite=None", t, func() {
+		So(validatePartitioned(&http.Cookie{Name: "a"}), ShouldBeNil)
+		So(validatePartitioned(&http.Cookie{Name: "a", Partitioned: true, Secure: true, SameSite: http.SameSiteNoneMode}), ShouldBeNil)
+		So(errors.Is(validatePartitioned(&http.Cookie{Name: "a", Partitioned: true, SameSite: http.SameSiteNoneMode}), ErrInvalidPartitionedCookie), ShouldBeTrue)
+		So(validatePartitioned(&http.Cookie{Name: "a", Partitioned: true, Secure: true, SameSite: http.SameSiteLaxMode}).Error(), ShouldContainSubstring, "must have SameSite=None, not Lax")
+	})
+}
@@ -1,13 +1,22 @@
 package cookies
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// ErrInvalidConsentID is returned when a consent ID has characters which cannot be written in the ons_cookie_policy
+// cookie
+var ErrInvalidConsentID = errors.New("invalid consent id")
+
 // PreferencesResponse is a combination of cookie policy and whether they have be set by user
 type PreferencesResponse struct {
 	IsPreferenceSet bool
@@ -18,6 +27,8 @@ type PreferencesResponse struct {
 type ONSPreferencesResponse struct {
 	IsPreferenceSet bool
 	Policy          ONSPolicy
+	// NeedsReconsent is true when the user's consent is for an outdated policy version or has expired, see ConsentConfig
+	NeedsReconsent bool
 }
 
 // Policy is cookie policy setting chosen by a user
@@ -37,6 +48,12 @@ type ONSPolicy struct {
 	Settings  bool `json:"settings"`
 	Usage     bool `json:"usage"`
 	Campaigns bool `json:"campaigns"`
+	// Version is the version of the cookie policy the user consented to
+	Version int `json:"version,omitempty"`
+	// ConsentedAt is the time the user gave consent
+	ConsentedAt CookieTime `json:"consented_at,omitzero"`
+	// ConsentID anonymously identifies the user's consent in the consent audit log, see SetONSConsent
+	ConsentID string `json:"consent_id,omitempty"`
 }
 
 var defaultONSPolicy = ONSPolicy{
@@ -56,23 +73,34 @@ func GetCookiePreferences(req *http.Request) PreferencesResponse {
 	}
 }
 
-// GetCookiePreferences returns a struct with all cookie preferences
+// GetONSCookiePreferences returns a struct with all ONS cookie preferences. Preferences needing reconsent, as
+// configured by SetConsentConfig, are reported as not set.
 func GetONSCookiePreferences(req *http.Request) ONSPreferencesResponse {
 	isPreferenceSet := getONSPreferencesIsSet(req)
 	cookiePolicy := getONSPolicy(req)
+	needsReconsent := isPreferenceSet && getConsentConfig().NeedsReconsent(cookiePolicy, time.Now())
 	return ONSPreferencesResponse{
-		IsPreferenceSet: isPreferenceSet,
+		IsPreferenceSet: isPreferenceSet && !needsReconsent,
 		Policy:          cookiePolicy,
+		NeedsReconsent:  needsReconsent,
 	}
 }
 
 // SetPreferenceIsSet sets a cookie to record a user has set cookie preferences
 //
-// Deprecated: Use SetONSPreferenceIsSet instead
+// Deprecated: Use SetONSConsent instead
 func SetPreferenceIsSet(w http.ResponseWriter, domain string) {
+	logSetError(context.Background(), cookiesPreferencesSetCookieKey, TrySetPreferenceIsSet(w, domain))
+}
+
+// TrySetPreferenceIsSet sets a cookie to record a user has set cookie preferences, returning an error if the cookie
+// cannot be set
+//
+// Deprecated: Use TrySetONSConsent instead
+func TrySetPreferenceIsSet(w http.ResponseWriter, domain string) error {
 	path := "/"
 	httpOnly := false
-	set(w, cookiesPreferencesSetCookieKey, "true", domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
+	return trySet(w, cookiesPreferencesSetCookieKey, "true", domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
 }
 
 func getPreferencesIsSet(req *http.Request) bool {
@@ -90,10 +118,20 @@ func getPreferencesIsSet(req *http.Request) bool {
 }
 
 // SetONSPreferenceIsSet sets the ONS cookie to record whether the user has set cookie preferences
+//
+// Deprecated: Use SetONSConsent instead, which passes the change to the ConsentRecorder
 func SetONSPreferenceIsSet(w http.ResponseWriter, domain string) {
+	logSetError(context.Background(), onsCookiePreferencesSetCookieKey, TrySetONSPreferenceIsSet(w, domain))
+}
+
+// TrySetONSPreferenceIsSet sets the ONS cookie to record whether the user has set cookie preferences, returning an
+// error if the cookie cannot be set
+//
+// Deprecated: Use TrySetONSConsent instead, which passes the change to the ConsentRecorder
+func TrySetONSPreferenceIsSet(w http.ResponseWriter, domain string) error {
 	path := "/"
 	httpOnly := false
-	set(w, onsCookiePreferencesSetCookieKey, "true", domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
+	return trySet(w, onsCookiePreferencesSetCookieKey, "true", domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
 }
 
 func getONSPreferencesIsSet(req *http.Request) bool {
@@ -112,67 +150,223 @@ func getONSPreferencesIsSet(req *http.Request) bool {
 
 // SetPolicy sets a cookie with the users preferences, or sets default preferences on error
 //
-// Deprecated: Use SetONSPolicy instead
+// Deprecated: Use SetONSConsent instead
 func SetPolicy(w http.ResponseWriter, policy Policy, domain string) {
 	b, err := json.Marshal(policy)
 	if err != nil {
 		b, _ = json.Marshal(defaultPolicy)
 	}
+	logSetError(context.Background(), cookiesPolicyCookieKey, trySetPolicyValue(w, string(b), domain))
+}
+
+// TrySetPolicy sets a cookie with the users preferences, returning an error rather than setting default preferences
+//
+// Deprecated: Use TrySetONSConsent instead
+func TrySetPolicy(w http.ResponseWriter, policy Policy, domain string) error {
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return trySetPolicyValue(w, string(b), domain)
+}
+
+func trySetPolicyValue(w http.ResponseWriter, value, domain string) error {
 	path := "/"
 	httpOnly := false
-	set(w, cookiesPolicyCookieKey, string(b), domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
+	return trySet(w, cookiesPolicyCookieKey, value, domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
 }
 
-// SetONSPolicy sets the ONS cookie with the users preferences, or sets default preferences on error
+// SetONSPolicy sets the ONS cookie with the users preferences, or sets default preferences on error. When consent
+// versioning is configured by SetConsentConfig, the current version and consent time are recorded, replacing any on the
+// policy.
+//
+// Deprecated: Use SetONSConsent instead, which passes the change to the ConsentRecorder
 func SetONSPolicy(w http.ResponseWriter, policy ONSPolicy, domain string) {
-	b, err := json.Marshal(policy)
+	setONSPolicy(w, getConsentConfig().stamp(policy, Now()), domain)
+}
+
+// TrySetONSPolicy sets the ONS cookie with the users preferences as SetONSPolicy does, returning an error rather than
+// setting default preferences
+//
+// Deprecated: Use TrySetONSConsent instead, which passes the change to the ConsentRecorder
+func TrySetONSPolicy(w http.ResponseWriter, policy ONSPolicy, domain string) error {
+	value, err := marshalONSPolicy(getConsentConfig().stamp(policy, Now()))
+	if err != nil {
+		return err
+	}
+	return trySetONSPolicyValue(w, value, domain)
+}
+
+// setONSPolicy sets the ONS cookie with the policy exactly as given, or with default preferences on error
+func setONSPolicy(w http.ResponseWriter, policy ONSPolicy, domain string) {
+	value, err := marshalONSPolicy(policy)
 	if err != nil {
-		b, _ = json.Marshal(defaultONSPolicy)
+		logSetError(context.Background(), onsCookiePolicyCookieKey, err)
+		value = encodeONSPolicy(defaultONSPolicy)
 	}
+	logSetError(context.Background(), onsCookiePolicyCookieKey, trySetONSPolicyValue(w, value, domain))
+}
+
+func trySetONSPolicyValue(w http.ResponseWriter, value, domain string) error {
 	path := "/"
 	httpOnly := false
-	setCookieWithUnencodedValue(w, onsCookiePolicyCookieKey, string(b), domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
+	return trySetUnencoded(w, onsCookiePolicyCookieKey, value, domain, path, maxAgeOneYear, http.SameSiteLaxMode, httpOnly)
+}
+
+// encodeONSPolicy returns the single quoted JSON value of an ons_cookie_policy cookie, or of the default policy on error
+func encodeONSPolicy(policy ONSPolicy) string {
+	value, err := marshalONSPolicy(policy)
+	if err != nil {
+		value, _ = marshalONSPolicy(defaultONSPolicy)
+	}
+	return value
+}
+
+// marshalONSPolicy returns the single quoted JSON value of an ons_cookie_policy cookie, or ErrInvalidConsentID when the
+// consent ID cannot be written in the cookie
+func marshalONSPolicy(policy ONSPolicy) (string, error) {
+	if !isValidConsentID(policy.ConsentID) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidConsentID, policy.ConsentID)
+	}
+
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(policy); err != nil {
+		return "", err
+	}
+	return singleQuote(strings.TrimSuffix(b.String(), "\n")), nil
+}
+
+// isValidConsentID reports whether the consent ID can be written in the ons_cookie_policy cookie, where it is a single
+// quoted string
+func isValidConsentID(id string) bool {
+	return !strings.ContainsFunc(id, func(r rune) bool { return !isCookieValueChar(r) || r == '\'' })
+}
+
+// singleQuote converts the double quoted strings of JSON to single quoted strings, the reverse of normaliseQuotes
+func singleQuote(js string) string {
+	var b strings.Builder
+	b.Grow(len(js))
+
+	for i := 0; i < len(js); i++ {
+		if js[i] != '"' {
+			b.WriteByte(js[i])
+			continue
+		}
+
+		b.WriteByte('\'')
+		for i++; i < len(js) && js[i] != '"'; i++ {
+			switch {
+			case js[i] == '\\' && i+1 < len(js):
+				i++
+				if js[i] != '"' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(js[i])
+			case js[i] == '\'':
+				b.WriteString(`\'`)
+			default:
+				b.WriteByte(js[i])
+			}
+		}
+		b.WriteByte('\'')
+	}
+
+	return b.String()
 }
 
 func getPolicy(req *http.Request) Policy {
 	cookiePolicyCookie, err := req.Cookie(cookiesPolicyCookieKey)
 	if err != nil {
+		// visitors without the deprecated cookie are expected, so are not counted as a fallback
 		return defaultPolicy
 	}
+	recordLegacyCookieSeen()
 
-	unescapedPolicy, err := url.QueryUnescape(cookiePolicyCookie.Value)
+	cookiePolicy, err := parsePolicy(cookiePolicyCookie.Value)
 	if err != nil {
+		recordParseFailure(req.Context(), cookiesPolicyCookieKey)
+		recordConsentFallback(req.Context(), cookiesPolicyCookieKey, ONSPolicyCorrupt.String())
 		return defaultPolicy
 	}
 
+	return cookiePolicy
+}
+
+// parsePolicy decodes the url encoded JSON value of a cookies_policy cookie
+func parsePolicy(value string) (Policy, error) {
+	unescapedPolicy, err := url.QueryUnescape(value)
+	if err != nil {
+		return Policy{}, err
+	}
+
 	cookiePolicy := Policy{}
-	jErr := json.Unmarshal([]byte(unescapedPolicy), &cookiePolicy)
-	if jErr != nil {
-		return defaultPolicy
+	if err := json.Unmarshal([]byte(unescapedPolicy), &cookiePolicy); err != nil {
+		return Policy{}, err
 	}
 
-	return cookiePolicy
+	return cookiePolicy, nil
 }
 
+// getONSPolicy reads the ons_cookie_policy cookie, counting a cookie which could not be read. For requests passed
+// through withONSPolicyCache each cookie value is only parsed, and counted, once.
 func getONSPolicy(req *http.Request) ONSPolicy {
-	cookiePolicyCookie, err := req.Cookie(onsCookiePolicyCookieKey)
-	if err != nil {
-		return defaultONSPolicy
+	cache, ok := req.Context().Value(onsPolicyCacheKey{}).(*onsPolicyCache)
+	if !ok {
+		return readONSPolicy(req)
 	}
 
-	unescapedPolicy, err := url.QueryUnescape(cookiePolicyCookie.Value)
-	if err != nil {
-		return defaultONSPolicy
+	var value string
+	if c, err := req.Cookie(onsCookiePolicyCookieKey); err == nil {
+		value = c.Value
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cookiePolicy, ok := cache.policies[value]
+	if !ok {
+		cookiePolicy = readONSPolicy(req)
+		cache.policies[value] = cookiePolicy
 	}
+	return cookiePolicy
+}
 
-	// Replace single quotes with double quotes to make it valid JSON
-	validJSONPolicy := strings.ReplaceAll(unescapedPolicy, "'", "\"")
+// onsPolicyCacheKey is the request context key of the onsPolicyCache
+type onsPolicyCacheKey struct{}
+
+// onsPolicyCache is the policies read from the ons_cookie_policy cookies of a request, by cookie value, so that a cookie
+// read by several handlers or writers is only counted once
+type onsPolicyCache struct {
+	mutex    sync.Mutex
+	policies map[string]ONSPolicy
+}
 
-	cookiePolicy := ONSPolicy{}
-	jErr := json.Unmarshal([]byte(validJSONPolicy), &cookiePolicy)
-	if jErr != nil {
-		return defaultONSPolicy
+// withONSPolicyCache returns a shallow copy of the request which caches the policies read by getONSPolicy, or the
+// request itself when it already does
+func withONSPolicyCache(req *http.Request) *http.Request {
+	if _, ok := req.Context().Value(onsPolicyCacheKey{}).(*onsPolicyCache); ok {
+		return req
 	}
+	return req.WithContext(context.WithValue(req.Context(), onsPolicyCacheKey{}, &onsPolicyCache{policies: map[string]ONSPolicy{}}))
+}
 
+// readONSPolicy reads the ons_cookie_policy cookie, counting a cookie which could not be read
+func readONSPolicy(req *http.Request) ONSPolicy {
+	cookiePolicy, diagnostic := GetONSPolicy(req)
+	switch diagnostic.Status {
+	case ONSPolicyCorrupt, ONSPolicyPartial:
+		recordParseFailure(req.Context(), onsCookiePolicyCookieKey)
+		recordConsentFallback(req.Context(), onsCookiePolicyCookieKey, diagnostic.Status.String())
+	case ONSPolicyNotRecorded:
+		recordConsentFallback(req.Context(), onsCookiePolicyCookieKey, diagnostic.Status.String())
+	}
 	return cookiePolicy
 }
+
+// parseONSPolicy strictly decodes the value of an ons_cookie_policy cookie, returning an error unless every
+// category could be read
+func parseONSPolicy(value string) (ONSPolicy, error) {
+	cookiePolicy, diagnostic := ParseONSPolicy(value)
+	return cookiePolicy, diagnostic.Err()
+}
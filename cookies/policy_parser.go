@@ -0,0 +1,211 @@
+package cookies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ONSPolicyStatus describes the outcome of reading the ons_cookie_policy cookie
+type ONSPolicyStatus int
+
+const (
+	// ONSPolicyNotRecorded is used when there is no ons_cookie_policy cookie, i.e. no consent has been recorded
+	ONSPolicyNotRecorded ONSPolicyStatus = iota
+
+	// ONSPolicyValid is used when every category in the cookie was read successfully
+	ONSPolicyValid
+
+	// ONSPolicyPartial is used when some categories were missing or invalid, and have been given their default value
+	ONSPolicyPartial
+
+	// ONSPolicyCorrupt is used when the cookie could not be read at all, and the default policy has been used
+	ONSPolicyCorrupt
+)
+
+func (s ONSPolicyStatus) String() string {
+	switch s {
+	case ONSPolicyNotRecorded:
+		return "not recorded"
+	case ONSPolicyValid:
+		return "valid"
+	case ONSPolicyPartial:
+		return "partial"
+	case ONSPolicyCorrupt:
+		return "corrupt"
+	default:
+		return fmt.Sprintf("ONSPolicyStatus(%d)", int(s))
+	}
+}
+
+// ONSPolicyDiagnostic reports how an ons_cookie_policy cookie was parsed
+type ONSPolicyDiagnostic struct {
+	Status ONSPolicyStatus
+	// MissingFields are the categories absent from the cookie, which have been given their default value
+	MissingFields []string
+	// InvalidFields are the fields which could not be read, categories are given their default value
+	InvalidFields []string
+	// UnknownFields are fields in the cookie which are not ONSPolicy categories, e.g. added by the cookie banner
+	UnknownFields []string
+	// Cause is the reason a corrupt cookie could not be read
+	Cause error
+}
+
+// ErrONSPolicyNotRecorded is returned by ONSPolicyDiagnostic.Err when no consent has been recorded
+var ErrONSPolicyNotRecorded = errors.New("ons cookie policy not recorded")
+
+// Err returns nil when the policy was read in full, otherwise an error describing the problem
+func (d ONSPolicyDiagnostic) Err() error {
+	switch d.Status {
+	case ONSPolicyValid:
+		return nil
+	case ONSPolicyNotRecorded:
+		return ErrONSPolicyNotRecorded
+	case ONSPolicyCorrupt:
+		return fmt.Errorf("corrupt ons cookie policy: %w", d.Cause)
+	default:
+		return fmt.Errorf("partial ons cookie policy: missing fields %v, invalid fields %v", d.MissingFields, d.InvalidFields)
+	}
+}
+
+// onsPolicyFields maps the JSON name of each ONSPolicy category to its value in the policy
+var onsPolicyFields = map[string]func(p *ONSPolicy) *bool{
+	CategoryEssential: func(p *ONSPolicy) *bool { return &p.Essential },
+	CategorySettings:  func(p *ONSPolicy) *bool { return &p.Settings },
+	CategoryUsage:     func(p *ONSPolicy) *bool { return &p.Usage },
+	CategoryCampaigns: func(p *ONSPolicy) *bool { return &p.Campaigns },
+}
+
+// onsPolicyMetadata maps the JSON name of each field recording how consent was given to its value in the policy
+var onsPolicyMetadata = map[string]func(p *ONSPolicy) interface{}{
+	"version":      func(p *ONSPolicy) interface{} { return &p.Version },
+	"consented_at": func(p *ONSPolicy) interface{} { return &p.ConsentedAt },
+	"consent_id":   func(p *ONSPolicy) interface{} { return &p.ConsentID },
+}
+
+// GetONSPolicy reads the ons_cookie_policy cookie. Unlike GetONSCookiePreferences the diagnostic allows callers to
+// tell a user who has not recorded consent from one whose consent cookie is corrupt.
+func GetONSPolicy(req *http.Request) (ONSPolicy, ONSPolicyDiagnostic) {
+	cookiePolicyCookie, err := req.Cookie(onsCookiePolicyCookieKey)
+	if err != nil {
+		return defaultONSPolicy, ONSPolicyDiagnostic{Status: ONSPolicyNotRecorded}
+	}
+
+	return ParseONSPolicy(cookiePolicyCookie.Value)
+}
+
+// ParseONSPolicy tolerantly parses the value of an ons_cookie_policy cookie. Both single and double quoted JSON are
+// accepted, unknown fields are ignored, and missing or invalid categories are given their default value.
+func ParseONSPolicy(value string) (ONSPolicy, ONSPolicyDiagnostic) {
+	corrupt := func(err error) (ONSPolicy, ONSPolicyDiagnostic) {
+		return defaultONSPolicy, ONSPolicyDiagnostic{Status: ONSPolicyCorrupt, Cause: err}
+	}
+
+	// the policy is written unencoded, so only values which are not already JSON are url decoded, otherwise a '+' or
+	// '%' in a string would be changed
+	unescapedPolicy := value
+	if !strings.HasPrefix(value, "{") {
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			unescapedPolicy = unescaped
+		}
+	}
+
+	validJSONPolicy, err := normaliseQuotes(unescapedPolicy)
+	if err != nil {
+		return corrupt(err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal([]byte(validJSONPolicy), &fields); err != nil {
+		return corrupt(err)
+	}
+	if fields == nil {
+		return corrupt(errors.New("policy is null"))
+	}
+
+	policy := defaultONSPolicy
+	diagnostic := ONSPolicyDiagnostic{Status: ONSPolicyValid}
+	for name, field := range onsPolicyFields {
+		raw, ok := fields[name]
+		if !ok {
+			diagnostic.MissingFields = append(diagnostic.MissingFields, name)
+			continue
+		}
+
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil || string(raw) == "null" {
+			diagnostic.InvalidFields = append(diagnostic.InvalidFields, name)
+			continue
+		}
+		*field(&policy) = b
+	}
+
+	for name, field := range onsPolicyMetadata {
+		if raw, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, field(&policy)); err != nil {
+				diagnostic.InvalidFields = append(diagnostic.InvalidFields, name)
+			}
+		}
+	}
+
+	for name := range fields {
+		_, isCategory := onsPolicyFields[name]
+		_, isMetadata := onsPolicyMetadata[name]
+		if !isCategory && !isMetadata {
+			diagnostic.UnknownFields = append(diagnostic.UnknownFields, name)
+		}
+	}
+
+	sort.Strings(diagnostic.MissingFields)
+	sort.Strings(diagnostic.InvalidFields)
+	sort.Strings(diagnostic.UnknownFields)
+	if len(diagnostic.MissingFields) > 0 || len(diagnostic.InvalidFields) > 0 {
+		diagnostic.Status = ONSPolicyPartial
+	}
+
+	return policy, diagnostic
+}
+
+// normaliseQuotes converts single quoted strings to double quoted JSON strings, leaving double quoted strings as they
+// are, so that the value written by setCookieWithUnencodedValue and the JS cookie banner can be read as JSON
+func normaliseQuotes(s string) (string, error) {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\'' && c != '"' {
+			b.WriteByte(c)
+			continue
+		}
+
+		start := i
+		b.WriteByte('"')
+		for i++; i < len(s) && s[i] != c; i++ {
+			switch {
+			case s[i] == '\\' && i+1 < len(s):
+				i++
+				if c == '\'' && s[i] == '\'' {
+					b.WriteByte('\'')
+				} else {
+					b.WriteByte('\\')
+					b.WriteByte(s[i])
+				}
+			case c == '\'' && s[i] == '"':
+				b.WriteString(`\"`)
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		if i >= len(s) {
+			return "", fmt.Errorf("unterminated string starting at offset %d", start)
+		}
+		b.WriteByte('"')
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,146 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseONSPolicy(t *testing.T) {
+	Convey("Given a policy written by SetONSPolicy", t, func() {
+		value := "{'essential':true,'settings':true,'usage':false,'campaigns':true}"
+
+		Convey("ParseONSPolicy reads every category", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true, Settings: true, Campaigns: true})
+			So(diagnostic, ShouldResemble, ONSPolicyDiagnostic{Status: ONSPolicyValid})
+			So(diagnostic.Err(), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a double quoted and url encoded policy", t, func() {
+		value := url.QueryEscape(`{"essential":true,"settings":false,"usage":true,"campaigns":false}`)
+
+		Convey("ParseONSPolicy reads every category", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true, Usage: true})
+			So(diagnostic.Status, ShouldEqual, ONSPolicyValid)
+		})
+	})
+
+	Convey("Given a policy with extra fields written by the cookie banner", t, func() {
+		value := `{'essential':true,'settings':true,'usage':true,'campaigns':false,'banner':'it\'s "2"','ts':1}`
+
+		Convey("ParseONSPolicy ignores the unknown fields and reports them", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true, Settings: true, Usage: true})
+			So(diagnostic.Status, ShouldEqual, ONSPolicyValid)
+			So(diagnostic.UnknownFields, ShouldResemble, []string{"banner", "ts"})
+		})
+	})
+
+	Convey("Given a policy with missing and invalid categories", t, func() {
+		value := "{'essential':true,'usage':'yes','campaigns':null}"
+
+		Convey("ParseONSPolicy keeps the valid categories and defaults the rest", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true})
+			So(diagnostic.Status, ShouldEqual, ONSPolicyPartial)
+			So(diagnostic.MissingFields, ShouldResemble, []string{"settings"})
+			So(diagnostic.InvalidFields, ShouldResemble, []string{"campaigns", "usage"})
+			So(diagnostic.Err(), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a partial policy where a user has consented to usage cookies", t, func() {
+		value := "{'usage':true}"
+
+		Convey("ParseONSPolicy does not reset the consent which was given", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true, Usage: true})
+			So(diagnostic.Status, ShouldEqual, ONSPolicyPartial)
+		})
+	})
+
+	Convey("Given values which cannot be read", t, func() {
+		for _, value := range []string{"", "not-json", "{'essential':true", "{'essential:true}", "[true]", "null"} {
+			Convey("ParseONSPolicy returns the default policy and reports a corrupt cookie for "+value, func() {
+				policy, diagnostic := ParseONSPolicy(value)
+				So(policy, ShouldResemble, defaultONSPolicy)
+				So(diagnostic.Status, ShouldEqual, ONSPolicyCorrupt)
+				So(diagnostic.Cause, ShouldNotBeNil)
+				So(diagnostic.Err().Error(), ShouldStartWith, "corrupt ons cookie policy")
+			})
+		}
+	})
+}
+
+func TestGetONSPolicy(t *testing.T) {
+	Convey("Given no ons_cookie_policy cookie", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+
+		Convey("GetONSPolicy reports that no consent is recorded", func() {
+			policy, diagnostic := GetONSPolicy(req)
+			So(policy, ShouldResemble, defaultONSPolicy)
+			So(diagnostic.Status, ShouldEqual, ONSPolicyNotRecorded)
+			So(errors.Is(diagnostic.Err(), ErrONSPolicyNotRecorded), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a corrupt ons_cookie_policy cookie", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "corrupt"})
+
+		Convey("GetONSPolicy reports that the cookie is corrupt", func() {
+			policy, diagnostic := GetONSPolicy(req)
+			So(policy, ShouldResemble, defaultONSPolicy)
+			So(diagnostic.Status, ShouldEqual, ONSPolicyCorrupt)
+		})
+	})
+
+	Convey("Given a partial ons_cookie_policy cookie", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':true}"})
+
+		Convey("GetONSCookiePreferences keeps the categories which were read", func() {
+			So(GetONSCookiePreferences(req).Policy, ShouldResemble, ONSPolicy{Essential: true, Settings: true})
+		})
+	})
+}
+
+func TestONSPolicyStatusString(t *testing.T) {
+	Convey("ONSPolicyStatus values have readable names", t, func() {
+		So(ONSPolicyNotRecorded.String(), ShouldEqual, "not recorded")
+		So(ONSPolicyValid.String(), ShouldEqual, "valid")
+		So(ONSPolicyPartial.String(), ShouldEqual, "partial")
+		So(ONSPolicyCorrupt.String(), ShouldEqual, "corrupt")
+		So(ONSPolicyStatus(9).String(), ShouldEqual, "ONSPolicyStatus(9)")
+	})
+}
+
+func TestParseONSPolicyConsentFields(t *testing.T) {
+	Convey("Given a policy recording its version and consent time", t, func() {
+		value := "{'essential':true,'settings':false,'usage':true,'campaigns':false,'version':3,'consented_at':'2021-01-01T15:31:23'}"
+
+		Convey("ParseONSPolicy reads them", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true, Usage: true, Version: 3, ConsentedAt: MustParseCookieTime("2021-01-01T15:31:23")})
+			So(diagnostic, ShouldResemble, ONSPolicyDiagnostic{Status: ONSPolicyValid})
+		})
+	})
+
+	Convey("Given a policy with an invalid consent time", t, func() {
+		value := "{'essential':true,'settings':false,'usage':true,'campaigns':false,'consented_at':'yesterday'}"
+
+		Convey("ParseONSPolicy keeps the categories and reports the invalid field", func() {
+			policy, diagnostic := ParseONSPolicy(value)
+			So(policy, ShouldResemble, ONSPolicy{Essential: true, Usage: true})
+			So(diagnostic.Status, ShouldEqual, ONSPolicyPartial)
+			So(diagnostic.InvalidFields, ShouldResemble, []string{"consented_at"})
+		})
+	})
+}
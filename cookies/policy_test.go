@@ -1,6 +1,7 @@
 package cookies
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -259,3 +260,75 @@ func TestUnitONSPolicy(t *testing.T) {
 		}
 	})
 }
+
+func TestTrySetPolicy(t *testing.T) {
+	Convey("Given valid preferences", t, func() {
+		rec := httptest.NewRecorder()
+
+		Convey("The policy and preferences set cookies are set as the fire-and-forget setters set them", func() {
+			legacy := httptest.NewRecorder()
+			SetONSPolicy(legacy, ONSPolicy{Essential: true, Usage: true}, "www.test.com")
+			SetONSPreferenceIsSet(legacy, "www.test.com")
+			SetPolicy(legacy, Policy{Essential: true}, "www.test.com")
+			SetPreferenceIsSet(legacy, "www.test.com")
+
+			So(TrySetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true}, "www.test.com"), ShouldBeNil)
+			So(TrySetONSPreferenceIsSet(rec, "www.test.com"), ShouldBeNil)
+			So(TrySetPolicy(rec, Policy{Essential: true}, "www.test.com"), ShouldBeNil)
+			So(TrySetPreferenceIsSet(rec, "www.test.com"), ShouldBeNil)
+			So(rec.Header().Values("Set-Cookie"), ShouldResemble, legacy.Header().Values("Set-Cookie"))
+		})
+	})
+
+	Convey("Given an invalid domain", t, func() {
+		rec := httptest.NewRecorder()
+
+		Convey("Each setter returns an error", func() {
+			So(errors.Is(TrySetONSPolicy(rec, ONSPolicy{Essential: true}, "a b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(errors.Is(TrySetONSPreferenceIsSet(rec, "a b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(errors.Is(TrySetPolicy(rec, Policy{Essential: true}, "a b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(errors.Is(TrySetPreferenceIsSet(rec, "a b"), ErrInvalidCookieDomain), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSetONSPolicyConsentID(t *testing.T) {
+	Convey("Given a policy with a consent ID", t, func() {
+		rec := httptest.NewRecorder()
+		So(TrySetONSPolicy(rec, ONSPolicy{Essential: true, ConsentID: "0123abcd"}, "www.test.com"), ShouldBeNil)
+
+		Convey("The consent ID is written single quoted", func() {
+			So(rec.Result().Cookies()[0].Value, ShouldEqual, "{'essential':true,'settings':false,'usage':false,'campaigns':false,'consent_id':'0123abcd'}")
+		})
+	})
+
+	Convey("Given a policy with a consent ID which cannot be written in the cookie", t, func() {
+		for _, id := range []string{`it's`, `"quoted"`, "a b", "a;b"} {
+			rec := httptest.NewRecorder()
+			So(errors.Is(TrySetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true, ConsentID: id}, "www.test.com"), ErrInvalidConsentID), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		}
+
+		Convey("SetONSPolicy sets default preferences", func() {
+			rec := httptest.NewRecorder()
+			SetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true, ConsentID: "it's"}, "www.test.com")
+			So(rec.Result().Cookies()[0].Value, ShouldEqual, encodeONSPolicy(defaultONSPolicy))
+		})
+	})
+}
+
+func TestSingleQuote(t *testing.T) {
+	Convey("Given JSON with strings which contain quotes", t, func() {
+		js := `{"a":"it's","b":"say \"hi\"","c":"back\\slash"}`
+
+		Convey("The strings are single quoted and read back as the same JSON", func() {
+			quoted := singleQuote(js)
+			So(quoted, ShouldEqual, `{'a':'it\'s','b':'say "hi"','c':'back\\slash'}`)
+
+			normalised, err := normaliseQuotes(quoted)
+			So(err, ShouldBeNil)
+			So(normalised, ShouldEqual, js)
+		})
+	})
+}
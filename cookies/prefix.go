@@ -0,0 +1,162 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CookiePrefix is a cookie name prefix which browsers use to enforce cookie attributes
+type CookiePrefix string
+
+const (
+	// NoPrefix writes a cookie under its legacy name
+	NoPrefix CookiePrefix = ""
+
+	// SecurePrefix requires the cookie to be Secure
+	SecurePrefix CookiePrefix = "__Secure-"
+
+	// HostPrefix requires the cookie to be Secure, have a Path of '/' and no Domain, i.e. it is only sent to the host
+	// which set it
+	HostPrefix CookiePrefix = "__Host-"
+)
+
+// ErrInvalidCookiePrefix is returned when a cookie cannot meet the requirements of the requested prefix
+var ErrInvalidCookiePrefix = errors.New("invalid cookie prefix")
+
+// prefixes are the cookie prefixes in the order getters look for them
+var prefixes = []CookiePrefix{HostPrefix, SecurePrefix}
+
+// SetUserAuthTokenWithPrefix sets a cookie containing users auth token ("access token") under the prefixed name, which
+// expires as configured. With HostPrefix the domain is not set, so the cookie is only sent to the host which set it.
+func SetUserAuthTokenWithPrefix(w http.ResponseWriter, userAuthToken, domain string, prefix CookiePrefix, expiry TokenExpiry) {
+	err := TrySetUserAuthTokenWithPrefix(w, userAuthToken, domain, prefix, expiry)
+	logSetError(context.Background(), string(prefix)+florenceCookieKey, err)
+}
+
+// TrySetUserAuthTokenWithPrefix sets a cookie containing users auth token ("access token") under the prefixed name as
+// SetUserAuthTokenWithPrefix does, returning an error if the cookie cannot be set
+func TrySetUserAuthTokenWithPrefix(w http.ResponseWriter, userAuthToken, domain string, prefix CookiePrefix, expiry TokenExpiry) error {
+	maxAge, err := expiry.maxAge(userAuthToken)
+	if err != nil {
+		return err
+	}
+	path := "/"
+	httpOnly := true
+	return trySetPrefixed(w, prefix, florenceCookieKey, userAuthToken, domain, path, maxAge, http.SameSiteStrictMode, httpOnly)
+}
+
+// SetRefreshTokenWithPrefix sets a cookie containing users refresh token ("refresh_token") under the prefixed name.
+// HostPrefix cannot be used, as the refresh token is scoped to the token refresh path.
+func SetRefreshTokenWithPrefix(w http.ResponseWriter, refreshToken, domain string, prefix CookiePrefix) {
+	logSetError(context.Background(), string(prefix)+refreshCookieKey, TrySetRefreshTokenWithPrefix(w, refreshToken, domain, prefix))
+}
+
+// TrySetRefreshTokenWithPrefix sets a cookie containing users refresh token ("refresh_token") under the prefixed name
+// as SetRefreshTokenWithPrefix does, returning an error if the cookie cannot be set
+func TrySetRefreshTokenWithPrefix(w http.ResponseWriter, refreshToken, domain string, prefix CookiePrefix) error {
+	path := "/api/v1/tokens/self"
+	httpOnly := true
+	return trySetPrefixed(w, prefix, refreshCookieKey, refreshToken, domain, path, maxAgeBrowserSession, http.SameSiteStrictMode, httpOnly)
+}
+
+// trySetPrefixed sets a cookie under the prefixed name, enforcing the requirements of the prefix: the cookie is always
+// Secure, and for HostPrefix the domain is dropped and the path must be '/'
+func trySetPrefixed(w http.ResponseWriter, prefix CookiePrefix, name, value, domain, path string, maxAge int, sameSite http.SameSite, httpOnly bool) error {
+	switch prefix {
+	case NoPrefix:
+		return trySet(w, name, value, domain, path, maxAge, sameSite, httpOnly)
+	case SecurePrefix:
+	case HostPrefix:
+		if path != "/" {
+			return fmt.Errorf("%w: %s%s requires a path of '/', not %q", ErrInvalidCookiePrefix, prefix, name, path)
+		}
+		domain = ""
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidCookiePrefix, prefix)
+	}
+
+	cookie := &http.Cookie{
+		Name:     string(prefix) + name,
+		Value:    url.QueryEscape(value),
+		Path:     path,
+		Domain:   domain,
+		HttpOnly: httpOnly,
+		Secure:   true,
+		MaxAge:   maxAge,
+		SameSite: sameSite,
+	}
+	partition(cookie)
+	return writeCookie(w, cookie)
+}
+
+// expirePrefixed removes a cookie written with a name prefix, meeting the prefix's requirements so that the browser
+// accepts it
+func expirePrefixed(w http.ResponseWriter, prefix CookiePrefix, name, domain, path string) {
+	cookie := &http.Cookie{
+		Name:   string(prefix) + name,
+		Path:   path,
+		Domain: domain,
+		Secure: true,
+		MaxAge: -1,
+	}
+	partition(cookie)
+	http.SetCookie(w, cookie)
+}
+
+// getPrefixed returns the value of the first of the prefixed cookies found, falling back to the cookie's legacy name
+// while clients are migrated
+func getPrefixed(req *http.Request, name string) (string, error) {
+	for _, prefix := range prefixes {
+		if value, err := get(req, string(prefix)+name); err == nil {
+			return value, nil
+		}
+	}
+
+	return get(req, name)
+}
+
+// cookiePrefix returns the prefix of the cookie getPrefixed reads, or NoPrefix when there is no prefixed cookie
+func cookiePrefix(req *http.Request, name string) CookiePrefix {
+	for _, prefix := range prefixes {
+		if _, err := req.Cookie(string(prefix) + name); err == nil {
+			return prefix
+		}
+	}
+	return NoPrefix
+}
+
+// splitPrefix returns the prefix of a cookie name, and the name without it
+func splitPrefix(name string) (CookiePrefix, string) {
+	for _, prefix := range prefixes {
+		if unprefixed, ok := strings.CutPrefix(name, string(prefix)); ok {
+			return prefix, unprefixed
+		}
+	}
+	return NoPrefix, name
+}
+
+// checkPrefix returns the requirements of the cookie's name prefix which it does not meet
+func checkPrefix(c *http.Cookie) []error {
+	prefix, _ := splitPrefix(c.Name)
+	if prefix == NoPrefix {
+		return nil
+	}
+
+	var errs []error
+	if !c.Secure {
+		errs = append(errs, fmt.Errorf("%s cookies must be secure", prefix))
+	}
+	if prefix == HostPrefix {
+		if c.Domain != "" {
+			errs = append(errs, fmt.Errorf("%s cookies must not have a domain", prefix))
+		}
+		if c.Path != "/" {
+			errs = append(errs, fmt.Errorf("%s cookies must have a path of '/'", prefix))
+		}
+	}
+	return errs
+}
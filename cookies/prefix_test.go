@@ -0,0 +1,191 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetUserAuthTokenWithPrefix(t *testing.T) {
+	testDomain := "www.test.com"
+
+	Convey("Given the __Host- prefix", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithPrefix(rec, "test-access-token", testDomain, HostPrefix, SessionExpiry)
+
+		Convey("The cookie is secure, host only and has a path of '/'", func() {
+			So(err, ShouldBeNil)
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, "__Host-access_token=test-access-token; Path=/; HttpOnly; Secure; SameSite=Strict")
+		})
+	})
+
+	Convey("Given the __Secure- prefix", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithPrefix(rec, "test-access-token", testDomain, SecurePrefix, SessionExpiry)
+
+		Convey("The cookie is secure and keeps its domain", func() {
+			So(err, ShouldBeNil)
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, "__Secure-access_token=test-access-token; Path=/; Domain=www.test.com; HttpOnly; Secure; SameSite=Strict")
+		})
+	})
+
+	Convey("Given no prefix", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithPrefix(rec, "test-access-token", testDomain, NoPrefix, SessionExpiry)
+
+		Convey("The cookie is written as SetUserAuthToken writes it", func() {
+			legacy := httptest.NewRecorder()
+			SetUserAuthToken(legacy, "test-access-token", testDomain)
+			So(err, ShouldBeNil)
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, legacy.Header().Get("Set-Cookie"))
+		})
+	})
+
+	Convey("Given an unknown prefix", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithPrefix(rec, "test-access-token", testDomain, "__Other-", SessionExpiry)
+
+		Convey("No cookie is written and an error is returned", func() {
+			So(errors.Is(err, ErrInvalidCookiePrefix), ShouldBeTrue)
+			So(rec.Header().Get("Set-Cookie"), ShouldBeEmpty)
+		})
+
+		Convey("SetUserAuthTokenWithPrefix logs the error", func() {
+			l := &testLogger{}
+			SetLogger(l)
+			Reset(func() { SetLogger(nil) })
+
+			SetUserAuthTokenWithPrefix(rec, "test-access-token", testDomain, "__Other-", SessionExpiry)
+			So(rec.Header().Get("Set-Cookie"), ShouldBeEmpty)
+			So(l.events, ShouldHaveLength, 1)
+			So(errors.Is(l.events[0].Err, ErrInvalidCookiePrefix), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given the __Host- prefix and the expiry taken from the token", t, func() {
+		rec := httptest.NewRecorder()
+		token := signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+		SetUserAuthTokenWithPrefix(rec, token, testDomain, HostPrefix, ExpiryFromToken)
+
+		Convey("The cookie lasts until the token's exp claim", func() {
+			cookies := rec.Result().Cookies()
+			So(cookies, ShouldHaveLength, 1)
+			So(cookies[0].Name, ShouldEqual, "__Host-access_token")
+			So(cookies[0].MaxAge, ShouldBeBetweenOrEqual, 3598, 3600)
+		})
+	})
+
+	Convey("Given an expiry in the past", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithPrefix(rec, "test-access-token", testDomain, HostPrefix, TokenExpiresAt(time.Now().Add(-time.Minute)))
+
+		Convey("No cookie is written and an error is returned", func() {
+			So(errors.Is(err, ErrTokenExpired), ShouldBeTrue)
+			So(rec.Header().Get("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSetRefreshTokenWithPrefix(t *testing.T) {
+	testDomain := "www.test.com"
+
+	Convey("Given the __Secure- prefix", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetRefreshTokenWithPrefix(rec, "test-refresh-token", testDomain, SecurePrefix)
+
+		Convey("The cookie is secure and keeps the refresh path", func() {
+			So(err, ShouldBeNil)
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, "__Secure-refresh_token=test-refresh-token; Path=/api/v1/tokens/self; Domain=www.test.com; HttpOnly; Secure; SameSite=Strict")
+		})
+	})
+
+	Convey("Given the __Host- prefix", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetRefreshTokenWithPrefix(rec, "test-refresh-token", testDomain, HostPrefix)
+
+		Convey("No cookie is written as the refresh path is not '/'", func() {
+			So(errors.Is(err, ErrInvalidCookiePrefix), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "/api/v1/tokens/self")
+			So(rec.Header().Get("Set-Cookie"), ShouldBeEmpty)
+		})
+
+		Convey("SetRefreshTokenWithPrefix logs the error", func() {
+			l := &testLogger{}
+			SetLogger(l)
+			Reset(func() { SetLogger(nil) })
+
+			SetRefreshTokenWithPrefix(rec, "test-refresh-token", testDomain, HostPrefix)
+			So(rec.Header().Get("Set-Cookie"), ShouldBeEmpty)
+			So(l.events, ShouldHaveLength, 1)
+			So(l.events[0].Data, ShouldResemble, map[string]interface{}{"name": "__Host-refresh_token"})
+		})
+	})
+}
+
+func TestGetPrefixedTokens(t *testing.T) {
+	Convey("Given requests with prefixed and legacy token cookies", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: florenceCookieKey, Value: "legacy"})
+		req.AddCookie(&http.Cookie{Name: "__Secure-" + florenceCookieKey, Value: "secure"})
+		req.AddCookie(&http.Cookie{Name: "__Host-" + florenceCookieKey, Value: "host"})
+		req.AddCookie(&http.Cookie{Name: refreshCookieKey, Value: "legacy-refresh"})
+		req.AddCookie(&http.Cookie{Name: "__Secure-" + refreshCookieKey, Value: "secure-refresh"})
+
+		Convey("The __Host- cookie is preferred, then the __Secure- cookie", func() {
+			token, err := GetUserAuthToken(req)
+			So(err, ShouldBeNil)
+			So(token, ShouldEqual, "host")
+
+			refresh, err := GetRefreshToken(req)
+			So(err, ShouldBeNil)
+			So(refresh, ShouldEqual, "secure-refresh")
+		})
+	})
+
+	Convey("Given a request with only the legacy cookie", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: florenceCookieKey, Value: "legacy"})
+
+		Convey("The legacy cookie is read", func() {
+			token, err := GetUserAuthToken(req)
+			So(err, ShouldBeNil)
+			So(token, ShouldEqual, "legacy")
+		})
+	})
+}
+
+func TestPrefixedDefinitions(t *testing.T) {
+	Convey("Given a cookie written with the __Host- prefix", t, func() {
+		rec := httptest.NewRecorder()
+		So(TrySetUserAuthTokenWithPrefix(rec, "token", "www.test.com", HostPrefix, SessionExpiry), ShouldBeNil)
+		cookie := rec.Result().Cookies()[0]
+
+		Convey("Lookup returns the unprefixed definition, which the cookie meets", func() {
+			d, ok := Lookup(cookie.Name)
+			So(ok, ShouldBeTrue)
+			So(d.Name, ShouldEqual, "__Host-access_token")
+			So(d.Check(cookie), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a prefixed cookie not meeting the prefix requirements", t, func() {
+		cookie := &http.Cookie{Name: "__Host-access_token", Value: "token", Path: "/", Domain: "www.test.com", HttpOnly: true, SameSite: http.SameSiteStrictMode}
+
+		Convey("Check reports each requirement which is not met", func() {
+			d, _ := Lookup(cookie.Name)
+			errs := d.Check(cookie)
+			So(errs, ShouldHaveLength, 2)
+			So(errs[0].Error(), ShouldEqual, "__Host- cookies must be secure")
+			So(errs[1].Error(), ShouldEqual, "__Host- cookies must not have a domain")
+		})
+	})
+
+	Convey("Lookup does not find prefixed names of unknown cookies", t, func() {
+		_, ok := Lookup("__Host-unknown")
+		So(ok, ShouldBeFalse)
+	})
+}
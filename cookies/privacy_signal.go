@@ -0,0 +1,104 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Cookie categories a user can consent to in an ONSPolicy
+const (
+	CategoryEssential = "essential"
+	CategorySettings  = "settings"
+	CategoryUsage     = "usage"
+	CategoryCampaigns = "campaigns"
+)
+
+// PolicySource explains how an effective policy was derived
+type PolicySource string
+
+const (
+	// PolicySourceDefault is used when the user has not made a choice, and no privacy signal applies
+	PolicySourceDefault PolicySource = "default"
+
+	// PolicySourceConsent is used when the policy is the choice made by the user
+	PolicySourceConsent PolicySource = "consent"
+
+	// PolicySourceGPC is used when non-essential cookies are rejected because of a 'Sec-GPC: 1' header
+	PolicySourceGPC PolicySource = "global-privacy-control"
+
+	// PolicySourceDNT is used when non-essential cookies are rejected because of a 'DNT: 1' header
+	PolicySourceDNT PolicySource = "do-not-track"
+)
+
+// EffectiveONSPolicy is the policy to apply to a request, and why it applies
+type EffectiveONSPolicy struct {
+	Policy ONSPolicy
+	Source PolicySource
+}
+
+// GetEffectiveONSPolicy returns the user's choice when they have made one. Otherwise, when enabled by
+// ConsentConfig.HonourGPC or ConsentConfig.HonourDNT, a Global Privacy Control or Do Not Track signal rejects every
+// non-essential category, and failing that the default policy applies.
+func GetEffectiveONSPolicy(req *http.Request) EffectiveONSPolicy {
+	preferences := GetONSCookiePreferences(req)
+	if preferences.IsPreferenceSet {
+		return EffectiveONSPolicy{Policy: preferences.Policy, Source: PolicySourceConsent}
+	}
+
+	if source, ok := privacySignal(req, getConsentConfig()); ok {
+		return EffectiveONSPolicy{Policy: ONSPolicy{Essential: true}, Source: source}
+	}
+
+	return EffectiveONSPolicy{Policy: defaultONSPolicy, Source: PolicySourceDefault}
+}
+
+// Allows reports whether the policy permits cookies of the given category
+func (e EffectiveONSPolicy) Allows(category string) bool {
+	field, ok := onsPolicyFields[category]
+	if !ok {
+		return false
+	}
+	return *field(&e.Policy)
+}
+
+// FromPrivacySignal reports whether the policy was derived from a browser privacy signal
+func (e EffectiveONSPolicy) FromPrivacySignal() bool {
+	return e.Source == PolicySourceGPC || e.Source == PolicySourceDNT
+}
+
+// CookieAllowed reports whether the effective policy for the request permits the named cookie to be written.
+// Cookies which are not in the registry are not allowed.
+func CookieAllowed(req *http.Request, name string) bool {
+	definition, ok := Lookup(name)
+	if !ok {
+		return false
+	}
+	return GetEffectiveONSPolicy(req).Allows(definition.Category)
+}
+
+// ErrRejectedByPrivacySignal is returned when a cookie is not set because a privacy signal rejects its category
+var ErrRejectedByPrivacySignal = errors.New("cookie rejected by privacy signal")
+
+// rejectedByPrivacySignal reports whether a privacy signal, rather than a choice made by the user, prevents the named
+// cookie from being written. Writers in this library use it so that they respect the signal automatically.
+func rejectedByPrivacySignal(req *http.Request, name string) bool {
+	definition, ok := Lookup(name)
+	if !ok {
+		return false
+	}
+
+	effective := GetEffectiveONSPolicy(req)
+	return effective.FromPrivacySignal() && !effective.Allows(definition.Category)
+}
+
+// privacySignal returns the enabled privacy signal sent with the request, if any
+func privacySignal(req *http.Request, cfg ConsentConfig) (PolicySource, bool) {
+	if cfg.HonourGPC && strings.TrimSpace(req.Header.Get("Sec-GPC")) == "1" {
+		return PolicySourceGPC, true
+	}
+	if cfg.HonourDNT && strings.TrimSpace(req.Header.Get("DNT")) == "1" {
+		return PolicySourceDNT, true
+	}
+	return "", false
+}
@@ -0,0 +1,113 @@
+package cookies
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetEffectiveONSPolicy(t *testing.T) {
+	Convey("Given privacy signals are not honoured", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("Sec-GPC", "1")
+		req.Header.Set("DNT", "1")
+
+		Convey("The default policy applies to a user without a choice", func() {
+			effective := GetEffectiveONSPolicy(req)
+			So(effective, ShouldResemble, EffectiveONSPolicy{Policy: defaultONSPolicy, Source: PolicySourceDefault})
+			So(effective.FromPrivacySignal(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given Global Privacy Control is honoured", t, func() {
+		SetConsentConfig(ConsentConfig{HonourGPC: true})
+		Reset(func() { SetConsentConfig(ConsentConfig{}) })
+
+		Convey("A user without a choice sending Sec-GPC rejects non-essential cookies", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Sec-GPC", "1")
+			effective := GetEffectiveONSPolicy(req)
+			So(effective, ShouldResemble, EffectiveONSPolicy{Policy: ONSPolicy{Essential: true}, Source: PolicySourceGPC})
+			So(effective.FromPrivacySignal(), ShouldBeTrue)
+			So(effective.Allows(CategoryEssential), ShouldBeTrue)
+			So(effective.Allows(CategoryUsage), ShouldBeFalse)
+		})
+
+		Convey("A Do Not Track header is ignored", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("DNT", "1")
+			So(GetEffectiveONSPolicy(req).Source, ShouldEqual, PolicySourceDefault)
+		})
+
+		Convey("An explicit choice made by the user takes precedence", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Sec-GPC", "1")
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':false,'usage':true,'campaigns':false}"})
+			req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+			effective := GetEffectiveONSPolicy(req)
+			So(effective.Source, ShouldEqual, PolicySourceConsent)
+			So(effective.Allows(CategoryUsage), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given Do Not Track is honoured", t, func() {
+		SetConsentConfig(ConsentConfig{HonourDNT: true})
+		Reset(func() { SetConsentConfig(ConsentConfig{}) })
+
+		Convey("A user without a choice sending DNT rejects non-essential cookies", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("DNT", "1")
+			So(GetEffectiveONSPolicy(req).Source, ShouldEqual, PolicySourceDNT)
+		})
+
+		Convey("A DNT header of 0 is ignored", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("DNT", "0")
+			So(GetEffectiveONSPolicy(req).Source, ShouldEqual, PolicySourceDefault)
+		})
+	})
+}
+
+func TestCookieAllowed(t *testing.T) {
+	Convey("Given a user who has consented to settings cookies only", t, func() {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "{'essential':true,'settings':true,'usage':false,'campaigns':false}"})
+		req.AddCookie(&http.Cookie{Name: onsCookiePreferencesSetCookieKey, Value: "true"})
+
+		Convey("Only cookies in consented categories are allowed", func() {
+			So(CookieAllowed(req, localeCookieKey), ShouldBeTrue)
+			So(CookieAllowed(req, florenceCookieKey), ShouldBeTrue)
+			So(CookieAllowed(req, aBTestKey), ShouldBeFalse)
+			So(CookieAllowed(req, "unknown"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestABTestPrivacySignal(t *testing.T) {
+	Convey("Given Global Privacy Control is honoured and a user without a choice sends Sec-GPC", t, func() {
+		SetConsentConfig(ConsentConfig{HonourGPC: true})
+		Reset(func() { SetConsentConfig(ConsentConfig{}) })
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("Sec-GPC", "1")
+
+		Convey("SetABTestCookieAspect does not write the a/b test cookie", func() {
+			rec := httptest.NewRecorder()
+			SetABTestCookieAspect(rec, req, testAspectID, testDomain, NewABTestCookieAspect(ABTestVariantNew, 0))
+			So(rec.Result().Cookies(), ShouldBeEmpty)
+		})
+
+		Convey("Handler serves the new handler without writing the a/b test cookie", func() {
+			oldHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(oldHandlerServed)) })
+			newHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(newHandlerServed)) })
+			rec := httptest.NewRecorder()
+			Handler(true, newHandler, oldHandler, 0, testAspectID, testDomain, "exit").ServeHTTP(rec, req)
+
+			b, _ := io.ReadAll(rec.Result().Body)
+			So(string(b), ShouldEqual, newHandlerServed)
+			So(rec.Result().Cookies(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package cookies
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// prometheusMetric describes a counter exposed by PrometheusMetrics
+type prometheusMetric struct {
+	name   string
+	help   string
+	labels []string
+}
+
+var (
+	cookieParseFailuresMetric = prometheusMetric{"cookie_parse_failures_total", "Cookies which could not be read, in full or in part.", []string{"cookie"}}
+	consentChoiceMetric       = prometheusMetric{"consent_choice_total", "Categories of consent given by users, by the value chosen.", []string{"category", "value"}}
+	consentFallbackMetric     = prometheusMetric{"consent_fallback_total", "Consent cookies replaced by the default policy, by the reason.", []string{"cookie", "reason"}}
+	abAssignmentsMetric       = prometheusMetric{"ab_assignments_total", "Users assigned to an a/b test variant.", []string{"aspect", "variant"}}
+	legacyCookieSeenMetric    = prometheusMetric{"legacy_cookie_seen_total", "Requests with the deprecated cookies_policy cookie.", nil}
+)
+
+// PrometheusMetrics is a MetricsCollector which exposes its counters in the Prometheus text format, so that they can
+// be scraped without a dependency on the Prometheus client library
+type PrometheusMetrics struct {
+	mutex    sync.Mutex
+	counters map[string]map[string]float64
+}
+
+// NewPrometheusMetrics returns a PrometheusMetrics with every counter at zero
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{counters: map[string]map[string]float64{}}
+}
+
+// CookieParseFailure increments cookie_parse_failures_total
+func (p *PrometheusMetrics) CookieParseFailure(cookie string) {
+	p.inc(cookieParseFailuresMetric, cookie)
+}
+
+// ConsentChoice increments consent_choice_total
+func (p *PrometheusMetrics) ConsentChoice(category string, value bool) {
+	p.inc(consentChoiceMetric, category, strconv.FormatBool(value))
+}
+
+// ConsentFallback increments consent_fallback_total
+func (p *PrometheusMetrics) ConsentFallback(cookie, reason string) {
+	p.inc(consentFallbackMetric, cookie, reason)
+}
+
+// ABTestAssignment increments ab_assignments_total
+func (p *PrometheusMetrics) ABTestAssignment(aspectID string, variant ABTestVariant) {
+	p.inc(abAssignmentsMetric, aspectID, string(variant))
+}
+
+// LegacyCookieSeen increments legacy_cookie_seen_total
+func (p *PrometheusMetrics) LegacyCookieSeen() {
+	p.inc(legacyCookieSeenMetric)
+}
+
+func (p *PrometheusMetrics) inc(metric prometheusMetric, labelValues ...string) {
+	var b strings.Builder
+	for i, label := range metric.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", label, escapeLabelValue(labelValues[i]))
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.counters[metric.name] == nil {
+		p.counters[metric.name] = map[string]float64{}
+	}
+	p.counters[metric.name][b.String()]++
+}
+
+// WriteTo writes every counter in the Prometheus text exposition format
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, metric := range []prometheusMetric{cookieParseFailuresMetric, consentChoiceMetric, consentFallbackMetric, abAssignmentsMetric, legacyCookieSeenMetric} {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s counter\n", metric.name, metric.help, metric.name)
+
+		series := p.counters[metric.name]
+		if len(metric.labels) == 0 {
+			fmt.Fprintf(cw, "%s %s\n", metric.name, strconv.FormatFloat(series[""], 'g', -1, 64))
+			continue
+		}
+
+		labels := make([]string, 0, len(series))
+		for l := range series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			fmt.Fprintf(cw, "%s{%s} %s\n", metric.name, l, strconv.FormatFloat(series[l], 'g', -1, 64))
+		}
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP writes every counter in the Prometheus text exposition format, so that PrometheusMetrics can be served at
+// a /metrics endpoint
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(w)
+}
+
+// escapeLabelValue escapes a label value as required by the Prometheus text format
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// countingWriter counts the bytes written, and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
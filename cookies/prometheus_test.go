@@ -0,0 +1,70 @@
+package cookies
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	Convey("Given a PrometheusMetrics with no events", t, func() {
+		metrics := NewPrometheusMetrics()
+
+		Convey("Each counter is exposed with its help and type", func() {
+			var buf bytes.Buffer
+			n, err := metrics.WriteTo(&buf)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, buf.Len())
+			So(buf.String(), ShouldEqual, `# HELP cookie_parse_failures_total Cookies which could not be read, in full or in part.
+# TYPE cookie_parse_failures_total counter
+# HELP consent_choice_total Categories of consent given by users, by the value chosen.
+# TYPE consent_choice_total counter
+# HELP consent_fallback_total Consent cookies replaced by the default policy, by the reason.
+# TYPE consent_fallback_total counter
+# HELP ab_assignments_total Users assigned to an a/b test variant.
+# TYPE ab_assignments_total counter
+# HELP legacy_cookie_seen_total Requests with the deprecated cookies_policy cookie.
+# TYPE legacy_cookie_seen_total counter
+legacy_cookie_seen_total 0
+`)
+		})
+	})
+
+	Convey("Given a PrometheusMetrics which has counted events", t, func() {
+		metrics := NewPrometheusMetrics()
+		metrics.CookieParseFailure(onsCookiePolicyCookieKey)
+		metrics.CookieParseFailure(onsCookiePolicyCookieKey)
+		metrics.CookieParseFailure(aBTestKey)
+		metrics.ConsentChoice(CategoryUsage, true)
+		metrics.ConsentFallback(onsCookiePolicyCookieKey, ONSPolicyCorrupt.String())
+		metrics.ABTestAssignment(`aspect "1"`, ABTestVariantNew)
+		metrics.LegacyCookieSeen()
+
+		Convey("The metrics endpoint serves each series in the Prometheus text format", func() {
+			rec := httptest.NewRecorder()
+			metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", http.NoBody))
+
+			So(rec.Header().Get("Content-Type"), ShouldEqual, "text/plain; version=0.0.4; charset=utf-8")
+			So(rec.Body.String(), ShouldEqual, `# HELP cookie_parse_failures_total Cookies which could not be read, in full or in part.
+# TYPE cookie_parse_failures_total counter
+cookie_parse_failures_total{cookie="ab_test"} 1
+cookie_parse_failures_total{cookie="ons_cookie_policy"} 2
+# HELP consent_choice_total Categories of consent given by users, by the value chosen.
+# TYPE consent_choice_total counter
+consent_choice_total{category="usage",value="true"} 1
+# HELP consent_fallback_total Consent cookies replaced by the default policy, by the reason.
+# TYPE consent_fallback_total counter
+consent_fallback_total{cookie="ons_cookie_policy",reason="corrupt"} 1
+# HELP ab_assignments_total Users assigned to an a/b test variant.
+# TYPE ab_assignments_total counter
+ab_assignments_total{aspect="aspect \"1\"",variant="new"} 1
+# HELP legacy_cookie_seen_total Requests with the deprecated cookies_policy cookie.
+# TYPE legacy_cookie_seen_total counter
+legacy_cookie_seen_total 1
+`)
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package cookies
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// safeReturnTo returns returnTo if it is a same-origin relative URL, otherwise the path and query of the request's
+// Referer if it has the same host as the request, otherwise fallback
+func safeReturnTo(req *http.Request, returnTo, fallback string) string {
+	if isRelativeURL(returnTo) {
+		return returnTo
+	}
+
+	if referer, err := url.Parse(req.Referer()); err == nil && referer.Host != "" && referer.Host == req.Host {
+		if target := referer.RequestURI(); isRelativeURL(target) {
+			return target
+		}
+	}
+
+	return fallback
+}
+
+// isRelativeURL reports whether target is a path on the current origin, i.e. it cannot redirect to another host
+func isRelativeURL(target string) bool {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return false
+	}
+	if strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
@@ -0,0 +1,43 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIsRelativeURL(t *testing.T) {
+	Convey("Same-origin paths are relative URLs", t, func() {
+		for _, target := range []string{"/", "/economy", "/economy?page=2#results", "/a//b"} {
+			So(isRelativeURL(target), ShouldBeTrue)
+		}
+	})
+
+	Convey("URLs which could leave the site are not relative URLs", t, func() {
+		for _, target := range []string{"", "economy", "//evil.example.com", "/\\evil.example.com", "https://evil.example.com/", "/\r\nLocation: x", "javascript:alert(1)"} {
+			So(isRelativeURL(target), ShouldBeFalse)
+		}
+	})
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	Convey("Given a request to www.ons.gov.uk", t, func() {
+		req := httptest.NewRequest(http.MethodPost, "http://www.ons.gov.uk/cookies", http.NoBody)
+
+		Convey("A relative return URL is used", func() {
+			So(safeReturnTo(req, "/people?x=1", "/"), ShouldEqual, "/people?x=1")
+		})
+
+		Convey("A same-origin Referer is used when there is no return URL", func() {
+			req.Header.Set("Referer", "https://www.ons.gov.uk/economy?page=2")
+			So(safeReturnTo(req, "", "/"), ShouldEqual, "/economy?page=2")
+		})
+
+		Convey("A Referer from another host is ignored", func() {
+			req.Header.Set("Referer", "https://evil.example.com/economy")
+			So(safeReturnTo(req, "https://evil.example.com/", "/fallback"), ShouldEqual, "/fallback")
+		})
+	})
+}
@@ -1,17 +1,24 @@
 package cookies
 
 import (
+	"context"
 	"net/http"
 )
 
 // SetRefreshToken sets a cookie containing users refresh token ("refresh_token")
 func SetRefreshToken(w http.ResponseWriter, refreshToken, domain string) {
+	logSetError(context.Background(), refreshCookieKey, TrySetRefreshToken(w, refreshToken, domain))
+}
+
+// TrySetRefreshToken sets a cookie containing users refresh token ("refresh_token"), returning an error if the cookie cannot be set
+func TrySetRefreshToken(w http.ResponseWriter, refreshToken, domain string) error {
 	path := "/api/v1/tokens/self"
 	httpOnly := true
-	set(w, refreshCookieKey, refreshToken, domain, path, maxAgeBrowserSession, http.SameSiteStrictMode, httpOnly)
+	return trySet(w, refreshCookieKey, refreshToken, domain, path, maxAgeBrowserSession, http.SameSiteStrictMode, httpOnly)
 }
 
-// GetRefreshToken reads refresh_token cookie and returns it's value
+// GetRefreshToken reads refresh_token cookie and returns it's value, preferring the __Secure- prefixed cookie written
+// by TrySetRefreshTokenWithPrefix
 func GetRefreshToken(req *http.Request) (string, error) {
-	return get(req, refreshCookieKey)
+	return getPrefixed(req, refreshCookieKey)
 }
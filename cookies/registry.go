@@ -0,0 +1,249 @@
+package cookies
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Definition describes a cookie written by this library, and how its value is decoded
+type Definition struct {
+	Name        string
+	Description string
+	// Category is the ONSPolicy category the user must consent to before the cookie is written
+	Category string
+	Path     string
+	MaxAge   int
+	// VariableMaxAge is true when the max age is chosen by the caller, e.g. to match a token's expiry
+	VariableMaxAge bool
+	SameSite       http.SameSite
+	HTTPOnly       bool
+	// Partitioned is true when the cookie has been configured by SetPartitioned
+	Partitioned bool
+	// Encoded is true when the value is url encoded, as written by set
+	Encoded bool
+	// Deprecated is true for cookies only kept for maintaining legacy systems
+	Deprecated bool
+	// Decode converts a raw cookie value to its typed representation
+	Decode func(value string) (interface{}, error)
+}
+
+var registry = map[string]Definition{
+	cookiesPolicyCookieKey: {
+		Name:        cookiesPolicyCookieKey,
+		Description: "legacy cookie policy",
+		Category:    CategoryEssential,
+		Path:        "/",
+		MaxAge:      maxAgeOneYear,
+		SameSite:    http.SameSiteLaxMode,
+		Encoded:     true,
+		Deprecated:  true,
+		Decode: func(value string) (interface{}, error) {
+			return parsePolicy(value)
+		},
+	},
+	onsCookiePolicyCookieKey: {
+		Name:        onsCookiePolicyCookieKey,
+		Description: "ONS cookie policy",
+		Category:    CategoryEssential,
+		Path:        "/",
+		MaxAge:      maxAgeOneYear,
+		SameSite:    http.SameSiteLaxMode,
+		Decode: func(value string) (interface{}, error) {
+			return parseONSPolicy(value)
+		},
+	},
+	cookiesPreferencesSetCookieKey: {
+		Name:        cookiesPreferencesSetCookieKey,
+		Description: "legacy cookie preferences set",
+		Category:    CategoryEssential,
+		Path:        "/",
+		MaxAge:      maxAgeOneYear,
+		SameSite:    http.SameSiteLaxMode,
+		Encoded:     true,
+		Deprecated:  true,
+		Decode:      decodeBool,
+	},
+	onsCookiePreferencesSetCookieKey: {
+		Name:        onsCookiePreferencesSetCookieKey,
+		Description: "ONS cookie preferences set",
+		Category:    CategoryEssential,
+		Path:        "/",
+		MaxAge:      maxAgeOneYear,
+		SameSite:    http.SameSiteLaxMode,
+		Encoded:     true,
+		Decode:      decodeBool,
+	},
+	localeCookieKey: {
+		Name:        localeCookieKey,
+		Description: "language",
+		Category:    CategorySettings,
+		Path:        "/",
+		MaxAge:      maxAgeOneYear,
+		SameSite:    http.SameSiteLaxMode,
+		Encoded:     true,
+		Decode:      decodeString,
+	},
+	florenceCookieKey: {
+		Name:           florenceCookieKey,
+		VariableMaxAge: true,
+		Description:    "Florence access token",
+		Category:       CategoryEssential,
+		Path:           "/",
+		MaxAge:         maxAgeBrowserSession,
+		SameSite:       http.SameSiteStrictMode,
+		HTTPOnly:       true,
+		Encoded:        true,
+		Decode:         decodeString,
+	},
+	idCookieKey: {
+		Name:           idCookieKey,
+		VariableMaxAge: true,
+		Description:    "Florence id token",
+		Category:       CategoryEssential,
+		Path:           "/",
+		MaxAge:         maxAgeBrowserSession,
+		SameSite:       http.SameSiteLaxMode,
+		Encoded:        true,
+		Decode:         decodeString,
+	},
+	refreshCookieKey: {
+		Name:        refreshCookieKey,
+		Description: "Florence refresh token",
+		Category:    CategoryEssential,
+		Path:        "/api/v1/tokens/self",
+		MaxAge:      maxAgeBrowserSession,
+		SameSite:    http.SameSiteStrictMode,
+		HTTPOnly:    true,
+		Encoded:     true,
+		Decode:      decodeString,
+	},
+	aBTestKey: {
+		Name:        aBTestKey,
+		Description: "a/b test aspects",
+		Category:    CategoryUsage,
+		Path:        "/",
+		MaxAge:      maxAgeOneYear,
+		SameSite:    http.SameSiteLaxMode,
+		Encoded:     true,
+		Decode: func(value string) (interface{}, error) {
+			cookie, err := parseABTestCookie(value)
+			return map[string]ABTestCookieAspect(cookie), err
+		},
+	},
+	collectionIDCookieKey: {
+		Name:        collectionIDCookieKey,
+		Description: "Florence collection",
+		Category:    CategoryEssential,
+		Path:        "/",
+		MaxAge:      maxAgeBrowserSession,
+		SameSite:    http.SameSiteLaxMode,
+		Encoded:     true,
+		Decode:      decodeString,
+	},
+	csrfCookieKey: {
+		Name:        csrfCookieKey,
+		Description: "CSRF token",
+		Category:    CategoryEssential,
+		Path:        "/",
+		MaxAge:      maxAgeBrowserSession,
+		SameSite:    http.SameSiteLaxMode,
+		HTTPOnly:    true,
+		Encoded:     true,
+		Decode: func(value string) (interface{}, error) {
+			// the signature can only be checked with the key, so only the format is checked
+			_, _, err := splitCSRFToken(value)
+			return value, err
+		},
+	},
+}
+
+// Registry returns the definitions of every cookie written by this library, ordered by name
+func Registry() []Definition {
+	definitions := make([]Definition, 0, len(registry))
+	for name := range registry {
+		d, _ := Lookup(name)
+		definitions = append(definitions, d)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+
+	return definitions
+}
+
+// Lookup returns the definition of the named cookie, if it is written by this library. Names with a __Host- or
+// __Secure- prefix return the definition of the unprefixed cookie, named with the prefix.
+func Lookup(name string) (Definition, bool) {
+	_, unprefixed := splitPrefix(name)
+	d, ok := registry[unprefixed]
+	if ok {
+		d.Name = name
+		if isPartitioned(unprefixed) {
+			d.Partitioned = true
+			d.SameSite = http.SameSiteNoneMode
+		}
+	}
+	return d, ok
+}
+
+// Check compares a cookie, as parsed from a Set-Cookie header, against the definition and returns every mismatch found
+func (d Definition) Check(c *http.Cookie) []error {
+	var errs []error
+
+	if c.Name != d.Name {
+		errs = append(errs, fmt.Errorf("name is %q, expected %q", c.Name, d.Name))
+	}
+	if d.Deprecated {
+		errs = append(errs, errors.New("cookie is deprecated"))
+	}
+	if c.Path != d.Path {
+		errs = append(errs, fmt.Errorf("path is %q, expected %q", c.Path, d.Path))
+	}
+	errs = append(errs, checkPrefix(c)...)
+	// a negative max age deletes the cookie, which is valid for any definition
+	if c.MaxAge >= 0 && c.MaxAge != d.MaxAge && !d.VariableMaxAge {
+		errs = append(errs, fmt.Errorf("max age is %d, expected %d", c.MaxAge, d.MaxAge))
+	}
+	if c.SameSite != d.SameSite {
+		errs = append(errs, fmt.Errorf("same site is %s, expected %s", sameSiteString(c.SameSite), sameSiteString(d.SameSite)))
+	}
+	if c.HttpOnly != d.HTTPOnly {
+		errs = append(errs, fmt.Errorf("http only is %t, expected %t", c.HttpOnly, d.HTTPOnly))
+	}
+	if c.Partitioned != d.Partitioned {
+		errs = append(errs, fmt.Errorf("partitioned is %t, expected %t", c.Partitioned, d.Partitioned))
+	}
+	if err := validatePartitioned(c); err != nil {
+		errs = append(errs, err)
+	}
+	if c.MaxAge >= 0 {
+		if _, err := d.Decode(c.Value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value: %w", err))
+		}
+	}
+
+	return errs
+}
+
+func decodeString(value string) (interface{}, error) {
+	return url.QueryUnescape(value)
+}
+
+func decodeBool(value string) (interface{}, error) {
+	return strconv.ParseBool(value)
+}
+
+func sameSiteString(s http.SameSite) string {
+	switch s {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return "unset"
+	}
+}
@@ -0,0 +1,107 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Registry returns every cookie definition ordered by name", t, func() {
+		definitions := Registry()
+		So(definitions, ShouldHaveLength, len(registry))
+		for i := 1; i < len(definitions); i++ {
+			So(definitions[i-1].Name, ShouldBeLessThan, definitions[i].Name)
+		}
+	})
+
+	Convey("Lookup", t, func() {
+		Convey("returns the definition of a known cookie", func() {
+			d, ok := Lookup(localeCookieKey)
+			So(ok, ShouldBeTrue)
+			So(d.Name, ShouldEqual, localeCookieKey)
+		})
+
+		Convey("reports an unknown cookie", func() {
+			_, ok := Lookup("unknown")
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given each setter in the library", t, func() {
+		setters := map[string]func(w http.ResponseWriter){
+			onsCookiePolicyCookieKey: func(w http.ResponseWriter) {
+				SetONSPolicy(w, ONSPolicy{Essential: true, Usage: true}, testDomain)
+			},
+			onsCookiePreferencesSetCookieKey: func(w http.ResponseWriter) { SetONSPreferenceIsSet(w, testDomain) },
+			localeCookieKey:                  func(w http.ResponseWriter) { SetLang(w, "cy", testDomain) },
+			florenceCookieKey:                func(w http.ResponseWriter) { SetUserAuthToken(w, "token", testDomain) },
+			idCookieKey:                      func(w http.ResponseWriter) { SetIDToken(w, "token", testDomain) },
+			refreshCookieKey:                 func(w http.ResponseWriter) { SetRefreshToken(w, "token", testDomain) },
+			collectionIDCookieKey:            func(w http.ResponseWriter) { SetCollection(w, "collection-123", testDomain) },
+			aBTestKey: func(w http.ResponseWriter) {
+				SetABTestCookieAspect(w, httptest.NewRequest("GET", "/", http.NoBody), testAspectID, testDomain, ABTestCookieAspect{})
+			},
+		}
+
+		Convey("The cookie written matches its definition in the registry", func() {
+			for name, setter := range setters {
+				rec := httptest.NewRecorder()
+				setter(rec)
+				cookie := rec.Result().Cookies()[0]
+
+				d, ok := Lookup(name)
+				So(ok, ShouldBeTrue)
+				So(d.Check(cookie), ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("Given a deprecated cookie written by its setter", t, func() {
+		rec := httptest.NewRecorder()
+		SetPolicy(rec, Policy{Essential: true}, testDomain) //nolint:staticcheck // testing deprecated cookie
+		d, _ := Lookup(cookiesPolicyCookieKey)
+
+		Convey("Check reports only that it is deprecated", func() {
+			errs := d.Check(rec.Result().Cookies()[0])
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].Error(), ShouldEqual, "cookie is deprecated")
+		})
+	})
+
+	Convey("Given a cookie which does not match its definition", t, func() {
+		c := &http.Cookie{Name: refreshCookieKey, Value: "%zz", Path: "/", MaxAge: 10, SameSite: http.SameSiteLaxMode}
+		d, _ := Lookup(refreshCookieKey)
+
+		Convey("Check reports every mismatch", func() {
+			errs := d.Check(c)
+			So(errs, ShouldHaveLength, 5)
+			So(errs[0].Error(), ShouldEqual, `path is "/", expected "/api/v1/tokens/self"`)
+			So(errs[1].Error(), ShouldEqual, "max age is 10, expected 0")
+			So(errs[2].Error(), ShouldEqual, "same site is Lax, expected Strict")
+			So(errs[3].Error(), ShouldEqual, "http only is false, expected true")
+			So(errs[4].Error(), ShouldContainSubstring, "invalid value")
+		})
+	})
+
+	Convey("Decode returns typed values", t, func() {
+		d, _ := Lookup(onsCookiePolicyCookieKey)
+		v, err := d.Decode("{'essential':true,'settings':false,'usage':true,'campaigns':false}")
+		So(err, ShouldBeNil)
+		So(v, ShouldResemble, ONSPolicy{Essential: true, Usage: true})
+
+		d, _ = Lookup(onsCookiePreferencesSetCookieKey)
+		v, err = d.Decode("true")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, true)
+
+		d, _ = Lookup(aBTestKey)
+		v, err = d.Decode(`{"aspect":{"new":"2020-06-16T17:28:45","old":"2020-06-15T17:28:45"}}`)
+		So(err, ShouldBeNil)
+		So(v, ShouldResemble, map[string]ABTestCookieAspect{
+			"aspect": {New: MustParseCookieTime("2020-06-16T17:28:45"), Old: MustParseCookieTime("2020-06-15T17:28:45")},
+		})
+	})
+}
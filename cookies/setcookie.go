@@ -0,0 +1,131 @@
+package cookies
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCookie is returned when a cookie cannot be written as a valid Set-Cookie header
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// formatSetCookie serialises a cookie as the value of a Set-Cookie header. Unlike http.Cookie.String, the value is
+// written exactly as given and never quoted, and an error is returned rather than invalid attributes being dropped.
+//
+// Values are restricted to the RFC 6265 cookie-octets, with the exception of ',' which browsers accept and which is
+// needed by the JSON value of the ons_cookie_policy cookie.
+func formatSetCookie(c *http.Cookie) (string, error) {
+	if !isCookieName(c.Name) {
+		return "", fmt.Errorf("%w: invalid name %q", ErrInvalidCookie, c.Name)
+	}
+	if i := strings.IndexFunc(c.Value, func(r rune) bool { return !isCookieValueChar(r) }); i >= 0 {
+		return "", fmt.Errorf("%w: invalid character %q in value of %q", ErrInvalidCookie, c.Value[i], c.Name)
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		if !isCookiePath(c.Path) {
+			return "", fmt.Errorf("%w: invalid path %q for %q", ErrInvalidCookie, c.Path, c.Name)
+		}
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Domain != "" {
+		domain := strings.TrimPrefix(c.Domain, ".")
+		if !isCookieDomain(domain) {
+			return "", fmt.Errorf("%w: invalid domain %q for %q", ErrInvalidCookie, c.Domain, c.Name)
+		}
+		b.WriteString("; Domain=")
+		b.WriteString(domain)
+	}
+	if !c.Expires.IsZero() {
+		if c.Expires.Year() < 1601 {
+			return "", fmt.Errorf("%w: invalid expiry %v for %q", ErrInvalidCookie, c.Expires, c.Name)
+		}
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(http.TimeFormat))
+	}
+	switch {
+	case c.MaxAge > 0:
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	case c.MaxAge < 0:
+		b.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	switch c.SameSite {
+	case http.SameSiteLaxMode:
+		b.WriteString("; SameSite=Lax")
+	case http.SameSiteStrictMode:
+		b.WriteString("; SameSite=Strict")
+	case http.SameSiteNoneMode:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String(), nil
+}
+
+// isCookieName reports whether name is a non-empty RFC 7230 token
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !isAlphaNumeric(c) && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieValueChar reports whether r is a cookie-octet, or ','
+func isCookieValueChar(r rune) bool {
+	return r > 0x20 && r < 0x7f && r != '"' && r != ';' && r != '\\'
+}
+
+// isCookiePath reports whether path can be written as a Path attribute and read back unchanged
+func isCookiePath(path string) bool {
+	for _, r := range path {
+		if !isCookieValueChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieDomain reports whether domain is a host name made of letters, digits, '-' and '_'
+func isCookieDomain(domain string) bool {
+	if domain == "" || len(domain) > 255 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			if !isAlphaNumeric(label[i]) && label[i] != '-' && label[i] != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isAlphaNumeric(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
@@ -0,0 +1,134 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormatSetCookie(t *testing.T) {
+	Convey("Given a cookie with every attribute", t, func() {
+		c := &http.Cookie{
+			Name:        "ons_cookie_policy",
+			Value:       "{'essential':true,'usage':false}",
+			Path:        "/",
+			Domain:      ".www.test.com",
+			Expires:     time.Date(2021, 1, 1, 15, 31, 23, 0, time.UTC),
+			MaxAge:      12,
+			HttpOnly:    true,
+			Secure:      true,
+			SameSite:    http.SameSiteStrictMode,
+			Partitioned: true,
+		}
+
+		Convey("The value is written unquoted and the attributes in the order net/http writes them", func() {
+			header, err := formatSetCookie(c)
+			So(err, ShouldBeNil)
+			So(header, ShouldEqual, "ons_cookie_policy={'essential':true,'usage':false}; Path=/; Domain=www.test.com; Expires=Fri, 01 Jan 2021 15:31:23 GMT; Max-Age=12; HttpOnly; Secure; SameSite=Strict; Partitioned")
+		})
+	})
+
+	Convey("Given a cookie with a negative max age", t, func() {
+		header, err := formatSetCookie(&http.Cookie{Name: "a", MaxAge: -1})
+
+		Convey("The cookie is written with a max age of 0", func() {
+			So(err, ShouldBeNil)
+			So(header, ShouldEqual, "a=; Max-Age=0")
+		})
+	})
+
+	Convey("Given cookies which cannot be written", t, func() {
+		for name, c := range map[string]*http.Cookie{
+			"an empty name":                  {Name: ""},
+			"a name with a separator":        {Name: "a=b"},
+			"a value with a double quote":    {Name: "a", Value: `{"essential":true}`},
+			"a value with a semicolon":       {Name: "a", Value: "a;b"},
+			"a value with a space":           {Name: "a", Value: "a b"},
+			"a value with a backslash":       {Name: "a", Value: `a\b`},
+			"a value with a non-ASCII char":  {Name: "a", Value: "café"},
+			"a path with a semicolon":        {Name: "a", Path: "/;Domain=evil.com"},
+			"a domain with an invalid char":  {Name: "a", Domain: "www.test.com;"},
+			"a domain with an empty label":   {Name: "a", Domain: "www..test.com"},
+			"an expiry before the year 1601": {Name: "a", Expires: time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC)},
+		} {
+			Convey("An error is returned for "+name, func() {
+				_, err := formatSetCookie(c)
+				So(errors.Is(err, ErrInvalidCookie), ShouldBeTrue)
+			})
+		}
+	})
+
+	Convey("Given a value setCookieWithUnencodedValue used to rewrite", t, func() {
+		rec := httptest.NewRecorder()
+		setCookieWithUnencodedValue(rec, "a", `{"essential":true}`, "www.test.com", "/", 12, http.SameSiteLaxMode, false)
+
+		Convey("The cookie is not set rather than its value being changed", func() {
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a value with braces which are not at its ends", t, func() {
+		rec := httptest.NewRecorder()
+		setCookieWithUnencodedValue(rec, "a", "x{'a':1},{'b':2}y", "www.test.com", "/", 12, http.SameSiteLaxMode, false)
+
+		Convey("The value is written unchanged", func() {
+			So(rec.Result().Cookies()[0].Value, ShouldEqual, "x{'a':1},{'b':2}y")
+		})
+	})
+}
+
+func FuzzFormatSetCookie(f *testing.F) {
+	f.Add("ons_cookie_policy", "{'essential':true,'settings':false,'usage':true,'campaigns':false}", "/", "www.test.com", maxAgeOneYear, true, false, int(http.SameSiteLaxMode), false)
+	f.Add("access_token", "test-access-token", "/", "", 0, true, true, int(http.SameSiteStrictMode), false)
+	f.Add("refresh_token", "a%2Bb%3D", "/api/v1/tokens/self", ".ons.gov.uk", -1, true, true, int(http.SameSiteNoneMode), true)
+	f.Add("lang", "", "", "", 0, false, false, 0, false)
+	f.Add("a", `"quoted"`, "/a b", "x..y", 1, false, false, 9, false)
+
+	f.Fuzz(func(t *testing.T, name, value, path, domain string, maxAge int, secure, httpOnly bool, sameSite int, partitioned bool) {
+		c := &http.Cookie{
+			Name:        name,
+			Value:       value,
+			Path:        path,
+			Domain:      domain,
+			MaxAge:      maxAge,
+			Secure:      secure,
+			HttpOnly:    httpOnly,
+			SameSite:    http.SameSite(sameSite),
+			Partitioned: partitioned,
+		}
+
+		header, err := formatSetCookie(c)
+		if err != nil {
+			return
+		}
+
+		parsed, err := http.ParseSetCookie(header)
+		if err != nil {
+			t.Fatalf("net/http cannot parse %q: %v", header, err)
+		}
+
+		want := *c
+		want.Domain = strings.TrimPrefix(domain, ".")
+		if want.MaxAge < 0 {
+			want.MaxAge = -1
+		}
+		switch want.SameSite {
+		case http.SameSiteLaxMode, http.SameSiteStrictMode, http.SameSiteNoneMode:
+		default:
+			want.SameSite = 0
+		}
+
+		got := *parsed
+		got.Raw = ""
+		if got.Name != want.Name || got.Value != want.Value || got.Path != want.Path || got.Domain != want.Domain ||
+			got.MaxAge != want.MaxAge || got.Secure != want.Secure || got.HttpOnly != want.HttpOnly ||
+			got.SameSite != want.SameSite || got.Partitioned != want.Partitioned || got.Quoted || len(got.Unparsed) > 0 {
+			t.Fatalf("%q parsed as %+v, expected %+v", header, got, want)
+		}
+	})
+}
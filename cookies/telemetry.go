@@ -0,0 +1,143 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the OpenTelemetry meter used by this library
+const instrumentationName = "github.com/ONSdigital/dp-cookies/cookies"
+
+// instruments are the OpenTelemetry counters updated by this library
+type instruments struct {
+	parseFailures     metric.Int64Counter
+	consentFallbacks  metric.Int64Counter
+	abTestAssignments metric.Int64Counter
+}
+
+var (
+	instrumentsMutex sync.RWMutex
+	otelInstruments  = newNoopInstruments()
+)
+
+func init() { //nolint:gochecknoinits // counters are created from the global provider, which is a no-op until set
+	if i, err := newInstruments(otel.GetMeterProvider()); err == nil {
+		otelInstruments = i
+	}
+}
+
+// SetMeterProvider sets the OpenTelemetry meter provider used to create this library's counters, or restores the
+// global provider when nil. By default the global provider is used, which records nothing until one is set by
+// otel.SetMeterProvider.
+func SetMeterProvider(provider metric.MeterProvider) error {
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+
+	i, err := newInstruments(provider)
+	if err != nil {
+		return err
+	}
+
+	instrumentsMutex.Lock()
+	defer instrumentsMutex.Unlock()
+	otelInstruments = i
+	return nil
+}
+
+func newInstruments(provider metric.MeterProvider) (*instruments, error) {
+	meter := provider.Meter(instrumentationName)
+
+	parseFailures, err := meter.Int64Counter("cookies.parse_failures",
+		metric.WithDescription("Cookies which could not be read, in full or in part"))
+	if err != nil {
+		return nil, err
+	}
+	consentFallbacks, err := meter.Int64Counter("cookies.consent_fallbacks",
+		metric.WithDescription("Requests where default consent was used for some or all categories"))
+	if err != nil {
+		return nil, err
+	}
+	abTestAssignments, err := meter.Int64Counter("cookies.ab_test_assignments",
+		metric.WithDescription("Users assigned to an a/b test variant"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &instruments{parseFailures: parseFailures, consentFallbacks: consentFallbacks, abTestAssignments: abTestAssignments}, nil
+}
+
+func newNoopInstruments() *instruments {
+	i, _ := newInstruments(noop.NewMeterProvider())
+	return i
+}
+
+func getInstruments() *instruments {
+	instrumentsMutex.RLock()
+	defer instrumentsMutex.RUnlock()
+	return otelInstruments
+}
+
+// recordParseFailure counts a cookie which could not be read
+func recordParseFailure(ctx context.Context, name string) {
+	getInstruments().parseFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("cookie", name)))
+	if collector, ok := getMetricsCollector(); ok {
+		collector.CookieParseFailure(name)
+	}
+}
+
+// recordConsentFallback counts a consent cookie which was replaced, in full or in part, by the default policy
+func recordConsentFallback(ctx context.Context, name, reason string) {
+	getInstruments().consentFallbacks.Add(ctx, 1, metric.WithAttributes(attribute.String("cookie", name), attribute.String("reason", reason)))
+	if collector, ok := getMetricsCollector(); ok {
+		collector.ConsentFallback(name, reason)
+	}
+}
+
+// recordABTest adds the aspect and variant serving the request to the current span, and counts the user's assignment to
+// the variant when an aspect was assigned
+func recordABTest(ctx context.Context, aspectID string, variant ABTestVariant, assigned bool) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("ab_test.aspect", aspectID),
+		attribute.String("ab_test.variant", string(variant)),
+		attribute.Bool("ab_test.assigned", assigned),
+	)
+
+	if assigned {
+		getInstruments().abTestAssignments.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("aspect", aspectID),
+			attribute.String("variant", string(variant)),
+		))
+		if collector, ok := getMetricsCollector(); ok {
+			collector.ABTestAssignment(aspectID, variant)
+		}
+	}
+}
+
+// TraceConsent is middleware which adds the effective ONS policy for each request, see GetEffectiveONSPolicy, to the
+// current OpenTelemetry span. Handlers in this library called by next read the policy without counting it again.
+func TraceConsent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req = withONSPolicyCache(req)
+		if span := trace.SpanFromContext(req.Context()); span.IsRecording() {
+			effective := GetEffectiveONSPolicy(req)
+			span.SetAttributes(
+				attribute.Bool("cookies.policy.essential", effective.Policy.Essential),
+				attribute.Bool("cookies.policy.settings", effective.Policy.Settings),
+				attribute.Bool("cookies.policy.usage", effective.Policy.Usage),
+				attribute.Bool("cookies.policy.campaigns", effective.Policy.Campaigns),
+				attribute.Int("cookies.policy.version", effective.Policy.Version),
+				attribute.String("cookies.policy.source", string(effective.Source)),
+			)
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,183 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useTestMeterProvider sets a meter provider whose counters are read with the returned function
+func useTestMeterProvider() func(name string, attrs ...attribute.KeyValue) int64 {
+	reader := sdkmetric.NewManualReader()
+	So(SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))), ShouldBeNil)
+	Reset(func() { So(SetMeterProvider(nil), ShouldBeNil) })
+
+	return func(name string, attrs ...attribute.KeyValue) int64 {
+		var rm metricdata.ResourceMetrics
+		So(reader.Collect(context.Background(), &rm), ShouldBeNil)
+
+		want := attribute.NewSet(attrs...)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != name {
+					continue
+				}
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					if dp.Attributes.Equals(&want) {
+						return dp.Value
+					}
+				}
+			}
+		}
+		return 0
+	}
+}
+
+// tracedRequest returns a request within a span which is exported, once ended, to the returned exporter
+func tracedRequest(req *http.Request) (*http.Request, func() map[attribute.Key]attribute.Value) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, span := provider.Tracer("test").Start(req.Context(), "request")
+
+	return req.WithContext(ctx), func() map[attribute.Key]attribute.Value {
+		span.End()
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range exporter.GetSpans()[0].Attributes {
+			attrs[kv.Key] = kv.Value
+		}
+		return attrs
+	}
+}
+
+func TestParseFailureMetrics(t *testing.T) {
+	Convey("Given a test meter provider", t, func() {
+		counter := useTestMeterProvider()
+
+		Convey("A corrupt ons_cookie_policy is counted as a parse failure and a fallback to the default policy", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: onsCookiePolicyCookieKey, Value: "corrupt"})
+			GetONSCookiePreferences(req)
+
+			So(counter("cookies.parse_failures", attribute.String("cookie", onsCookiePolicyCookieKey)), ShouldEqual, 1)
+			So(counter("cookies.consent_fallbacks", attribute.String("cookie", onsCookiePolicyCookieKey), attribute.String("reason", "corrupt")), ShouldEqual, 1)
+		})
+
+		Convey("A missing ons_cookie_policy is counted as a fallback, but not a parse failure", func() {
+			GetONSCookiePreferences(httptest.NewRequest("GET", "/", http.NoBody))
+
+			So(counter("cookies.parse_failures", attribute.String("cookie", onsCookiePolicyCookieKey)), ShouldEqual, 0)
+			So(counter("cookies.consent_fallbacks", attribute.String("cookie", onsCookiePolicyCookieKey), attribute.String("reason", "not recorded")), ShouldEqual, 1)
+		})
+
+		Convey("A valid ons_cookie_policy is not counted", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.Header.Set("Cookie", onsCookiePolicyCookieKey+"={'essential':true,'settings':true,'usage':true,'campaigns':true}")
+			GetONSCookiePreferences(req)
+
+			So(counter("cookies.consent_fallbacks", attribute.String("cookie", onsCookiePolicyCookieKey), attribute.String("reason", "valid")), ShouldEqual, 0)
+		})
+
+		Convey("A corrupt cookies_policy is counted", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: cookiesPolicyCookieKey, Value: "corrupt"})
+			GetCookiePreferences(req)
+
+			So(counter("cookies.parse_failures", attribute.String("cookie", cookiesPolicyCookieKey)), ShouldEqual, 1)
+		})
+
+		Convey("A corrupt ab_test cookie is counted", func() {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: aBTestKey, Value: "corrupt"})
+			GetABTestCookieAspect(req, testAspectID)
+
+			So(counter("cookies.parse_failures", attribute.String("cookie", aBTestKey)), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestABTestTelemetry(t *testing.T) {
+	newHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+	oldHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+
+	Convey("Given a test meter provider and a traced request without an a/b test cookie", t, func() {
+		counter := useTestMeterProvider()
+		req, spanAttributes := tracedRequest(httptest.NewRequest("GET", "/", http.NoBody))
+
+		Convey("When the user is assigned to the new handler", func() {
+			Handler(true, newHandler, oldHandler, 100, testAspectID, testDomain, "exit-new").ServeHTTP(httptest.NewRecorder(), req)
+
+			Convey("The aspect and variant are added to the span and the assignment is counted", func() {
+				attrs := spanAttributes()
+				So(attrs["ab_test.aspect"].AsString(), ShouldEqual, testAspectID)
+				So(attrs["ab_test.variant"].AsString(), ShouldEqual, "new")
+				So(attrs["ab_test.assigned"].AsBool(), ShouldBeTrue)
+				So(counter("cookies.ab_test_assignments", attribute.String("aspect", testAspectID), attribute.String("variant", "new")), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the user exits the new handler", func() {
+			req.URL.RawQuery = "exit-new"
+			Handler(true, newHandler, oldHandler, 100, testAspectID, testDomain, "exit-new").ServeHTTP(httptest.NewRecorder(), req)
+
+			Convey("The assignment to the old handler is counted", func() {
+				So(spanAttributes()["ab_test.variant"].AsString(), ShouldEqual, "old")
+				So(counter("cookies.ab_test_assignments", attribute.String("aspect", testAspectID), attribute.String("variant", "old")), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a traced request with an a/b test aspect", t, func() {
+		counter := useTestMeterProvider()
+		rec := httptest.NewRecorder()
+		SetABTestCookieAspect(rec, httptest.NewRequest("GET", "/", http.NoBody), testAspectID, testDomain, NewABTestCookieAspect(ABTestVariantOld, time.Hour))
+		req, spanAttributes := tracedRequest(browserRequest(rec))
+
+		Handler(true, newHandler, oldHandler, 100, testAspectID, testDomain, "exit-new").ServeHTTP(httptest.NewRecorder(), req)
+
+		Convey("The variant is added to the span, but no assignment is counted", func() {
+			attrs := spanAttributes()
+			So(attrs["ab_test.variant"].AsString(), ShouldEqual, "old")
+			So(attrs["ab_test.assigned"].AsBool(), ShouldBeFalse)
+			So(counter("cookies.ab_test_assignments", attribute.String("aspect", testAspectID), attribute.String("variant", "old")), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestTraceConsent(t *testing.T) {
+	Convey("Given a traced request from a user who has consented to usage cookies", t, func() {
+		rec := httptest.NewRecorder()
+		SetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true}, testDomain)
+		SetONSPreferenceIsSet(rec, testDomain)
+		req, spanAttributes := tracedRequest(browserRequest(rec))
+
+		Convey("TraceConsent adds the effective policy to the span", func() {
+			TraceConsent(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+			attrs := spanAttributes()
+			So(attrs["cookies.policy.essential"].AsBool(), ShouldBeTrue)
+			So(attrs["cookies.policy.settings"].AsBool(), ShouldBeFalse)
+			So(attrs["cookies.policy.usage"].AsBool(), ShouldBeTrue)
+			So(attrs["cookies.policy.campaigns"].AsBool(), ShouldBeFalse)
+			So(attrs["cookies.policy.source"].AsString(), ShouldEqual, string(PolicySourceConsent))
+		})
+	})
+
+	Convey("Given a request without a span", t, func() {
+		called := false
+		handler := TraceConsent(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+
+		Convey("TraceConsent calls the next handler", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", http.NoBody))
+			So(called, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// ErrTokenExpired is returned when a token cookie would expire as soon as it is written
+var ErrTokenExpired = errors.New("token has expired")
+
+// TokenExpiry sets when the access_token and id_token cookies expire. The zero value is SessionExpiry.
+type TokenExpiry struct {
+	at        time.Time
+	fromToken bool
+}
+
+var (
+	// SessionExpiry expires the cookie when the browser is closed
+	SessionExpiry = TokenExpiry{}
+
+	// ExpiryFromToken expires the cookie at the time of the token's exp claim, or when the browser is closed if the
+	// token does not have one. The token must be a JWT. Once the browser has removed an access_token cookie,
+	// TokenRefreshHandler refreshes it from the refresh_token cookie.
+	ExpiryFromToken = TokenExpiry{fromToken: true}
+)
+
+// TokenExpiresAt expires the cookie at the given time
+func TokenExpiresAt(t time.Time) TokenExpiry {
+	return TokenExpiry{at: t}
+}
+
+// maxAge returns the max age of a cookie holding the token
+func (e TokenExpiry) maxAge(token string) (int, error) {
+	at := e.at
+	if e.fromToken {
+		claims, err := ParseJWTClaims(token)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read token expiry: %w", err)
+		}
+		at = claims.ExpiresAt
+	}
+	if at.IsZero() {
+		return maxAgeBrowserSession, nil
+	}
+
+	seconds := math.Ceil(time.Until(at).Seconds())
+	if seconds <= 0 {
+		return 0, fmt.Errorf("%w at %s", ErrTokenExpired, at.UTC().Format(time.RFC3339))
+	}
+	return int(math.Min(seconds, math.MaxInt32)), nil
+}
+
+// SetUserAuthTokenWithExpiry sets a cookie containing users auth token ("access token") which expires as configured
+func SetUserAuthTokenWithExpiry(w http.ResponseWriter, userAuthToken, domain string, expiry TokenExpiry) {
+	logSetError(context.Background(), florenceCookieKey, TrySetUserAuthTokenWithExpiry(w, userAuthToken, domain, expiry))
+}
+
+// TrySetUserAuthTokenWithExpiry sets a cookie containing users auth token ("access token") which expires as
+// configured, returning an error if the cookie cannot be set
+func TrySetUserAuthTokenWithExpiry(w http.ResponseWriter, userAuthToken, domain string, expiry TokenExpiry) error {
+	maxAge, err := expiry.maxAge(userAuthToken)
+	if err != nil {
+		return err
+	}
+	path := "/"
+	httpOnly := true
+	return trySet(w, florenceCookieKey, userAuthToken, domain, path, maxAge, http.SameSiteStrictMode, httpOnly)
+}
+
+// SetIDTokenWithExpiry sets a cookie containing users id token ("id_token") which expires as configured
+func SetIDTokenWithExpiry(w http.ResponseWriter, idToken, domain string, expiry TokenExpiry) {
+	logSetError(context.Background(), idCookieKey, TrySetIDTokenWithExpiry(w, idToken, domain, expiry))
+}
+
+// TrySetIDTokenWithExpiry sets a cookie containing users id token ("id_token") which expires as configured, returning
+// an error if the cookie cannot be set
+func TrySetIDTokenWithExpiry(w http.ResponseWriter, idToken, domain string, expiry TokenExpiry) error {
+	maxAge, err := expiry.maxAge(idToken)
+	if err != nil {
+		return err
+	}
+	path := "/"
+	httpOnly := false
+	return trySet(w, idCookieKey, idToken, domain, path, maxAge, http.SameSiteLaxMode, httpOnly)
+}
@@ -0,0 +1,125 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetTokenWithExpiry(t *testing.T) {
+	testDomain := "www.test.com"
+	expiresAt := time.Now().Add(time.Hour)
+	token := signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": expiresAt.Unix()})
+
+	Convey("Given an explicit expiry", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithExpiry(rec, "test-access-token", testDomain, TokenExpiresAt(time.Now().Add(time.Hour)))
+
+		Convey("The cookie lasts until then", func() {
+			So(err, ShouldBeNil)
+			So(rec.Result().Cookies()[0].MaxAge, ShouldBeBetweenOrEqual, 3599, 3600)
+		})
+	})
+
+	Convey("Given the expiry is taken from the token", t, func() {
+		rec := httptest.NewRecorder()
+		SetUserAuthTokenWithExpiry(rec, token, testDomain, ExpiryFromToken)
+		SetIDTokenWithExpiry(rec, token, testDomain, ExpiryFromToken)
+
+		Convey("The cookies last until the token's exp claim", func() {
+			cookies := rec.Result().Cookies()
+			So(cookies, ShouldHaveLength, 2)
+			for _, c := range cookies {
+				So(c.MaxAge, ShouldBeBetweenOrEqual, 3598, 3600)
+			}
+		})
+
+		Convey("The cookies match their registered definitions", func() {
+			for _, c := range rec.Result().Cookies() {
+				d, _ := Lookup(c.Name)
+				So(d.Check(c), ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("Given the expiry is taken from a token without an exp claim", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetIDTokenWithExpiry(rec, signTestJWT("RS256", "rsa-key", map[string]interface{}{"sub": "test-subject"}), testDomain, ExpiryFromToken)
+
+		Convey("The cookie expires when the browser is closed", func() {
+			So(err, ShouldBeNil)
+			So(rec.Result().Cookies()[0].MaxAge, ShouldEqual, maxAgeBrowserSession)
+		})
+	})
+
+	Convey("Given the expiry is taken from a token which is not a JWT", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithExpiry(rec, "test-access-token", testDomain, ExpiryFromToken)
+
+		Convey("No cookie is written and an error is returned", func() {
+			So(errors.Is(err, ErrInvalidJWT), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an expiry in the past", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetIDTokenWithExpiry(rec, "test-id-token", testDomain, TokenExpiresAt(time.Now().Add(-time.Minute)))
+
+		Convey("No cookie is written and ErrTokenExpired is returned", func() {
+			So(errors.Is(err, ErrTokenExpired), ShouldBeTrue)
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given session expiry", t, func() {
+		rec := httptest.NewRecorder()
+		err := TrySetUserAuthTokenWithExpiry(rec, token, testDomain, SessionExpiry)
+
+		Convey("The cookie is written as SetUserAuthToken writes it", func() {
+			legacy := httptest.NewRecorder()
+			SetUserAuthToken(legacy, token, testDomain)
+			So(err, ShouldBeNil)
+			So(rec.Header().Get("Set-Cookie"), ShouldEqual, legacy.Header().Get("Set-Cookie"))
+		})
+	})
+}
+
+func TestFlorenceSessionExpiry(t *testing.T) {
+	Convey("Given a session expiring with its tokens", t, func() {
+		token := signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+		session := FlorenceSession{Domain: "www.test.com", AccessToken: token, IDToken: token, RefreshToken: "test-refresh-token", Expiry: ExpiryFromToken}
+		rec := httptest.NewRecorder()
+		err := session.Save(rec)
+
+		Convey("The access and id token cookies expire with the tokens and the refresh token cookie with the browser", func() {
+			So(err, ShouldBeNil)
+			maxAges := map[string]int{}
+			for _, c := range rec.Result().Cookies() {
+				maxAges[c.Name] = c.MaxAge
+			}
+			So(maxAges[florenceCookieKey], ShouldBeGreaterThan, 3500)
+			So(maxAges[idCookieKey], ShouldBeGreaterThan, 3500)
+			So(maxAges[refreshCookieKey], ShouldEqual, maxAgeBrowserSession)
+		})
+	})
+
+	Convey("Given a token refresh handler expiring cookies with the refreshed tokens", t, func() {
+		token := signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+		refresh := NewTokenRefreshHandler("www.test.com", TokenRefresherFunc(func(_ context.Context, _ string) (RefreshedTokens, error) {
+			return RefreshedTokens{AccessToken: token, IDToken: token}, nil
+		}))
+		refresh.Expiry = ExpiryFromToken
+		rec := httptest.NewRecorder()
+		refresh.ServeHTTP(rec, tokenRequest(time.Now(), "test-refresh-token"))
+
+		Convey("The refreshed access token cookie expires with the token", func() {
+			So(rec.Result().Cookies()[0].Name, ShouldEqual, florenceCookieKey)
+			So(rec.Result().Cookies()[0].MaxAge, ShouldBeGreaterThan, 3500)
+		})
+	})
+}
@@ -0,0 +1,168 @@
+package cookies
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshLeeway is how long before the access token expires that TokenRefreshHandler refreshes it
+const DefaultRefreshLeeway = time.Minute
+
+// RefreshedTokens are the tokens returned by a TokenRefresher
+type RefreshedTokens struct {
+	AccessToken string
+	// IDToken is optional, the id_token cookie is kept when empty
+	IDToken string
+	// RefreshToken is optional, and is only set when the identity provider rotates refresh tokens
+	RefreshToken string
+}
+
+// TokenRefresher exchanges a refresh token for new tokens, e.g. by calling the identity API's /tokens/self endpoint
+type TokenRefresher interface {
+	Refresh(ctx context.Context, refreshToken string) (RefreshedTokens, error)
+}
+
+// TokenRefresherFunc is a function which implements TokenRefresher
+type TokenRefresherFunc func(ctx context.Context, refreshToken string) (RefreshedTokens, error)
+
+// Refresh calls f
+func (f TokenRefresherFunc) Refresh(ctx context.Context, refreshToken string) (RefreshedTokens, error) {
+	return f(ctx, refreshToken)
+}
+
+// TokenRefreshHandler refreshes an expired or expiring access_token, or a missing one when there is a refresh token,
+// e.g. once the browser has removed an access_token cookie set with ExpiryFromToken. The new access_token and id_token
+// cookies are written with the prefixes of the cookies they replace, and the session is cleared when the refresh fails.
+// Concurrent requests carrying the same refresh token share one refresh.
+//
+// The handler is mounted on /api/v1/tokens/self, as SetRefreshToken scopes the refresh_token cookie to that path, so
+// browsers only send it there. Clients call it when their access token expires, or before it does. It responds with a
+// 204 No Content when the tokens are valid, whether or not they were refreshed, and a 401 Unauthorized when there is no
+// refresh token or the refresh fails. Access tokens which are not a JWT are not refreshed.
+type TokenRefreshHandler struct {
+	// Domain is the domain of the cookies written and expired
+	Domain string
+	// Leeway is how long before the access token expires that it is refreshed
+	Leeway time.Duration
+	// Expiry sets when the refreshed access_token and id_token cookies expire
+	Expiry TokenExpiry
+
+	refresher TokenRefresher
+	calls     refreshGroup
+}
+
+// NewTokenRefreshHandler returns a TokenRefreshHandler for the domain, refreshing tokens DefaultRefreshLeeway before
+// they expire
+func NewTokenRefreshHandler(domain string, refresher TokenRefresher) *TokenRefreshHandler {
+	return &TokenRefreshHandler{Domain: domain, Leeway: DefaultRefreshLeeway, refresher: refresher}
+}
+
+func (t *TokenRefreshHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// an access token which is missing, rather than not a JWT, may have been removed by the browser when it expired
+	var claims Claims
+	if accessToken, err := GetUserAuthToken(req); err == nil && accessToken != "" {
+		if claims, err = GetUserAuthTokenClaims(req); err != nil || !claims.IsExpired(t.Leeway) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	refreshToken, err := GetRefreshToken(req)
+	if err != nil || refreshToken == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	// the refresh is shared with other requests, so must not be cancelled when this request is
+	ctx := context.WithoutCancel(req.Context())
+	tokens, err := t.calls.do(refreshToken, func() (RefreshedTokens, error) {
+		return t.refresher.Refresh(ctx, refreshToken)
+	})
+
+	// the refreshed tokens keep the prefixes of the cookies they replace, or of the refresh token when the access token
+	// has been removed
+	session := FlorenceSession{
+		Domain:             t.Domain,
+		Expiry:             t.Expiry,
+		AccessTokenPrefix:  cookiePrefix(req, florenceCookieKey),
+		RefreshTokenPrefix: cookiePrefix(req, refreshCookieKey),
+	}
+	if _, cookieErr := req.Cookie(string(session.AccessTokenPrefix) + florenceCookieKey); cookieErr != nil {
+		session.AccessTokenPrefix = session.RefreshTokenPrefix
+	}
+	if err == nil {
+		idToken, _ := GetIDToken(req)
+		session.AccessToken = tokens.AccessToken
+		session.IDToken = firstNonEmpty(tokens.IDToken, idToken)
+		session.RefreshToken = firstNonEmpty(tokens.RefreshToken, refreshToken)
+		err = session.Save(w)
+	}
+	if err != nil {
+		getLogger().Error(req.Context(), "error refreshing tokens, clearing session", err, nil)
+		session.Clear(w)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	getLogger().Info(req.Context(), "refreshed tokens", logData{"expired_at": claims.ExpiresAt})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// refreshGroup coalesces concurrent refreshes of the same refresh token into one call
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+// testHookRefreshJoined is called as a caller starts waiting for a refresh in progress, so tests can synchronise on it
+var testHookRefreshJoined = func() {}
+
+type refreshCall struct {
+	done   chan struct{}
+	tokens RefreshedTokens
+	err    error
+}
+
+// do calls refresh, unless a call for the key is in progress, in which case its result is returned once it completes
+func (g *refreshGroup) do(key string, refresh func() (RefreshedTokens, error)) (RefreshedTokens, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*refreshCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		testHookRefreshJoined()
+		<-call.done
+		return call.tokens, call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				call.err = fmt.Errorf("token refresher panicked: %v", r)
+			}
+		}()
+		call.tokens, call.err = refresh()
+	}()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+
+	return call.tokens, call.err
+}
@@ -0,0 +1,215 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testRefresher returns new tokens for "test-refresh-token", counting its calls
+type testRefresher struct {
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (r *testRefresher) Refresh(_ context.Context, refreshToken string) (RefreshedTokens, error) {
+	r.calls.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	if refreshToken != "test-refresh-token" {
+		return RefreshedTokens{}, errors.New("invalid refresh token")
+	}
+	return RefreshedTokens{AccessToken: "new-access-token", IDToken: "new-id-token"}, nil
+}
+
+// tokenRequest returns a request carrying an access token expiring at the given time and a refresh token
+func tokenRequest(expiresAt time.Time, refreshToken string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens/self", http.NoBody)
+	req.AddCookie(&http.Cookie{Name: florenceCookieKey, Value: signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": expiresAt.Unix()})})
+	req.AddCookie(&http.Cookie{Name: idCookieKey, Value: "old-id-token"})
+	if refreshToken != "" {
+		req.AddCookie(&http.Cookie{Name: refreshCookieKey, Value: refreshToken})
+	}
+	return req
+}
+
+func TestTokenRefreshHandler(t *testing.T) {
+	Convey("Given the token refresh handler", t, func() {
+		refresher := &testRefresher{}
+		handler := NewTokenRefreshHandler("www.test.com", refresher)
+
+		Convey("When the access token is not expiring", func() {
+			req := tokenRequest(time.Now().Add(time.Hour), "test-refresh-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The tokens are not refreshed", func() {
+				So(rec.Code, ShouldEqual, http.StatusNoContent)
+				So(refresher.calls.Load(), ShouldEqual, 0)
+				So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the access token expires within the leeway", func() {
+			req := tokenRequest(time.Now().Add(30*time.Second), "test-refresh-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The access and id tokens are refreshed and the refresh token is kept", func() {
+				expected := httptest.NewRecorder()
+				SetUserAuthToken(expected, "new-access-token", "www.test.com")
+				SetIDToken(expected, "new-id-token", "www.test.com")
+				SetRefreshToken(expected, "test-refresh-token", "www.test.com")
+
+				So(rec.Code, ShouldEqual, http.StatusNoContent)
+				So(refresher.calls.Load(), ShouldEqual, 1)
+				So(rec.Header().Values("Set-Cookie"), ShouldResemble, expected.Header().Values("Set-Cookie"))
+			})
+		})
+
+		Convey("When the refresh fails", func() {
+			req := tokenRequest(time.Now().Add(-time.Minute), "expired-refresh-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The session is cleared", func() {
+				cleared := httptest.NewRecorder()
+				(&FlorenceSession{Domain: "www.test.com"}).Clear(cleared)
+				So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+				So(rec.Header().Values("Set-Cookie"), ShouldResemble, cleared.Header().Values("Set-Cookie"))
+			})
+		})
+
+		Convey("When there is no refresh token", func() {
+			req := tokenRequest(time.Now().Add(-time.Minute), "")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The request is unauthorised", func() {
+				So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+				So(refresher.calls.Load(), ShouldEqual, 0)
+				So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the access token has been removed by the browser but the refresh token is sent", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens/self", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: refreshCookieKey, Value: "test-refresh-token"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The tokens are refreshed", func() {
+				So(rec.Code, ShouldEqual, http.StatusNoContent)
+				So(refresher.calls.Load(), ShouldEqual, 1)
+				session := FlorenceSession{}
+				So(session.Load(browserRequest(rec)), ShouldBeNil)
+				So(session, ShouldResemble, FlorenceSession{AccessToken: "new-access-token", IDToken: "new-id-token", RefreshToken: "test-refresh-token"})
+			})
+		})
+
+		Convey("When the access token is not a JWT", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens/self", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: florenceCookieKey, Value: "test-access-token"})
+			req.AddCookie(&http.Cookie{Name: refreshCookieKey, Value: "test-refresh-token"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The tokens are not refreshed", func() {
+				So(rec.Code, ShouldEqual, http.StatusNoContent)
+				So(refresher.calls.Load(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the expiring tokens have name prefixes", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens/self", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: "__Host-access_token", Value: signTestJWT("RS256", "rsa-key", map[string]interface{}{"exp": time.Now().Unix()})})
+			req.AddCookie(&http.Cookie{Name: "__Secure-refresh_token", Value: "test-refresh-token"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The refreshed tokens are written with the same prefixes, and no cookies are expired", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldHaveLength, 3)
+				So(written["__Host-access_token"].Value, ShouldEqual, "new-access-token")
+				So(written["__Host-access_token"].Domain, ShouldBeEmpty)
+				So(written["__Secure-refresh_token"].Value, ShouldEqual, "test-refresh-token")
+				So(written[idCookieKey].Value, ShouldEqual, "new-id-token")
+				for _, c := range written {
+					So(c.Secure || c.Name == idCookieKey, ShouldBeTrue)
+					So(c.MaxAge, ShouldBeGreaterThanOrEqualTo, 0)
+				}
+			})
+		})
+
+		Convey("When the prefixed access token has been removed by the browser", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens/self", http.NoBody)
+			req.AddCookie(&http.Cookie{Name: "__Secure-refresh_token", Value: "test-refresh-token"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Convey("The access token is written with the prefix of the refresh token", func() {
+				written := writtenCookies(rec)
+				So(written, ShouldContainKey, "__Secure-access_token")
+				So(written, ShouldNotContainKey, florenceCookieKey)
+			})
+		})
+	})
+
+	Convey("Given concurrent requests with the same expiring token", t, func() {
+		refresher := &testRefresher{release: make(chan struct{})}
+		handler := NewTokenRefreshHandler("www.test.com", refresher)
+		expiresAt := time.Now()
+
+		// the first request's refresh is held until every other request is waiting for it
+		var joined sync.WaitGroup
+		joined.Add(9)
+		testHookRefreshJoined = joined.Done
+		Reset(func() { testHookRefreshJoined = func() {} })
+
+		recs := make([]*httptest.ResponseRecorder, 10)
+		var wg sync.WaitGroup
+		for i := range recs {
+			recs[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler.ServeHTTP(recs[i], tokenRequest(expiresAt, "test-refresh-token"))
+			}()
+		}
+		joined.Wait()
+		close(refresher.release)
+		wg.Wait()
+
+		Convey("The tokens are refreshed once and every response writes the refreshed tokens", func() {
+			So(refresher.calls.Load(), ShouldEqual, 1)
+			for _, rec := range recs {
+				So(rec.Code, ShouldEqual, http.StatusNoContent)
+				So(writtenCookies(rec)[florenceCookieKey].Value, ShouldEqual, "new-access-token")
+			}
+		})
+	})
+}
+
+func TestRefreshGroup(t *testing.T) {
+	Convey("Given a refresher which panics", t, func() {
+		group := refreshGroup{}
+		_, err := group.do("test-refresh-token", func() (RefreshedTokens, error) { panic("test panic") })
+
+		Convey("An error is returned and later calls are not blocked", func() {
+			So(err, ShouldNotBeNil)
+			tokens, err := group.do("test-refresh-token", func() (RefreshedTokens, error) {
+				return RefreshedTokens{AccessToken: "new-access-token"}, nil
+			})
+			So(err, ShouldBeNil)
+			So(tokens.AccessToken, ShouldEqual, "new-access-token")
+		})
+	})
+}
@@ -1,17 +1,22 @@
 package cookies
 
 import (
+	"context"
 	"net/http"
 )
 
 // SetUserAuthToken sets a cookie containing users auth token ("access token")
 func SetUserAuthToken(w http.ResponseWriter, userAuthToken, domain string) {
-	path := "/"
-	httpOnly := true
-	set(w, florenceCookieKey, userAuthToken, domain, path, maxAgeBrowserSession, http.SameSiteStrictMode, httpOnly)
+	logSetError(context.Background(), florenceCookieKey, TrySetUserAuthToken(w, userAuthToken, domain))
 }
 
-// GetUserAuthToken reads access_token  cookie and returns it's value
+// TrySetUserAuthToken sets a cookie containing users auth token ("access token"), returning an error if the cookie cannot be set
+func TrySetUserAuthToken(w http.ResponseWriter, userAuthToken, domain string) error {
+	return TrySetUserAuthTokenWithExpiry(w, userAuthToken, domain, SessionExpiry)
+}
+
+// GetUserAuthToken reads access_token  cookie and returns it's value, preferring the __Host- and __Secure- prefixed
+// cookies written by TrySetUserAuthTokenWithPrefix
 func GetUserAuthToken(req *http.Request) (string, error) {
-	return get(req, florenceCookieKey)
+	return getPrefixed(req, florenceCookieKey)
 }
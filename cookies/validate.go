@@ -0,0 +1,116 @@
+package cookies
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// MaxCookieSize is the largest cookie, measured as the length of its Set-Cookie header value, which every browser
+	// is required to store by RFC 6265
+	MaxCookieSize = 4096
+
+	// DefaultResponseCookieBudget is a budget for the Set-Cookie headers of a response which stays well within the
+	// header size limits of the load balancers and proxies in front of the website
+	DefaultResponseCookieBudget = 8192
+)
+
+var (
+	// ErrCookieTooLarge is returned when a cookie is larger than MaxCookieSize
+	ErrCookieTooLarge = errors.New("cookie too large")
+
+	// ErrInvalidCookieDomain is returned when a cookie's domain is invalid, or does not match the request host
+	ErrInvalidCookieDomain = errors.New("invalid cookie domain")
+
+	// ErrInvalidCookiePath is returned when a cookie's path is invalid
+	ErrInvalidCookiePath = errors.New("invalid cookie path")
+
+	// ErrInsecureSameSiteNone is returned when a cookie has SameSite=None without Secure, which browsers reject
+	ErrInsecureSameSiteNone = errors.New("SameSite=None cookie is not secure")
+
+	// ErrCookieBudgetExceeded is returned when the Set-Cookie headers of a response exceed the budget
+	ErrCookieBudgetExceeded = errors.New("cookie budget exceeded")
+)
+
+// ValidateCookie returns an error for each reason a browser would reject or truncate the cookie: an invalid name,
+// value, domain or path, a size over MaxCookieSize, or SameSite=None without Secure
+func ValidateCookie(c *http.Cookie) error {
+	var errs []error
+
+	if c.Path != "" && (!strings.HasPrefix(c.Path, "/") || !isCookiePath(c.Path)) {
+		errs = append(errs, fmt.Errorf("%w: %q for %q", ErrInvalidCookiePath, c.Path, c.Name))
+	}
+	if c.Domain != "" && !isCookieDomain(strings.TrimPrefix(c.Domain, ".")) {
+		errs = append(errs, fmt.Errorf("%w: %q for %q", ErrInvalidCookieDomain, c.Domain, c.Name))
+	}
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInsecureSameSiteNone, c.Name))
+	}
+	if err := validatePartitioned(c); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	header, err := formatSetCookie(c)
+	if err != nil {
+		return err
+	}
+	if len(header) > MaxCookieSize {
+		return fmt.Errorf("%w: %q is %d bytes, the maximum is %d", ErrCookieTooLarge, c.Name, len(header), MaxCookieSize)
+	}
+
+	return nil
+}
+
+// ValidateCookieForRequest validates the cookie as ValidateCookie does, and checks that its domain matches the
+// request host, as otherwise the browser would reject it
+func ValidateCookieForRequest(req *http.Request, c *http.Cookie) error {
+	if err := ValidateCookie(c); err != nil {
+		return err
+	}
+	if c.Domain == "" {
+		return nil
+	}
+
+	host := requestHost(req)
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+
+	if host == domain || (strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q does not match the request host %q for %q", ErrInvalidCookieDomain, c.Domain, host, c.Name)
+}
+
+// CheckResponseCookieBudget returns an error when the combined size of the Set-Cookie headers exceeds the budget, in
+// bytes, e.g. DefaultResponseCookieBudget
+func CheckResponseCookieBudget(header http.Header, budget int) error {
+	size := 0
+	for _, value := range header.Values("Set-Cookie") {
+		size += len("Set-Cookie: ") + len(value) + len("\r\n")
+	}
+
+	if size > budget {
+		return fmt.Errorf("%w: Set-Cookie headers are %d bytes, the budget is %d", ErrCookieBudgetExceeded, size, budget)
+	}
+	return nil
+}
+
+// writeCookie validates the cookie and adds its Set-Cookie header to the response. The value is written as given, so
+// must already be encoded.
+func writeCookie(w http.ResponseWriter, c *http.Cookie) error {
+	if err := ValidateCookie(c); err != nil {
+		return err
+	}
+
+	header, err := formatSetCookie(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Set-Cookie", header)
+	return nil
+}
@@ -0,0 +1,144 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateCookie(t *testing.T) {
+	Convey("Given a valid cookie", t, func() {
+		c := &http.Cookie{Name: "lang", Value: "cy", Path: "/", Domain: "www.ons.gov.uk", MaxAge: maxAgeOneYear, SameSite: http.SameSiteLaxMode}
+
+		Convey("No error is returned", func() {
+			So(ValidateCookie(c), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a cookie larger than MaxCookieSize", t, func() {
+		c := &http.Cookie{Name: "lang", Value: strings.Repeat("a", MaxCookieSize)}
+
+		Convey("ErrCookieTooLarge is returned", func() {
+			So(errors.Is(ValidateCookie(c), ErrCookieTooLarge), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a cookie with an invalid path", t, func() {
+		for _, path := range []string{"api", "/a;b", "/a b"} {
+			Convey("ErrInvalidCookiePath is returned for "+path, func() {
+				So(errors.Is(ValidateCookie(&http.Cookie{Name: "a", Path: path}), ErrInvalidCookiePath), ShouldBeTrue)
+			})
+		}
+	})
+
+	Convey("Given a cookie with an invalid domain", t, func() {
+		for _, domain := range []string{"www.ons.gov.uk:443", "www..ons.gov.uk", "ons gov uk"} {
+			Convey("ErrInvalidCookieDomain is returned for "+domain, func() {
+				So(errors.Is(ValidateCookie(&http.Cookie{Name: "a", Domain: domain}), ErrInvalidCookieDomain), ShouldBeTrue)
+			})
+		}
+	})
+
+	Convey("Given a SameSite=None cookie which is not secure", t, func() {
+		c := &http.Cookie{Name: "a", SameSite: http.SameSiteNoneMode}
+
+		Convey("ErrInsecureSameSiteNone is returned", func() {
+			So(errors.Is(ValidateCookie(c), ErrInsecureSameSiteNone), ShouldBeTrue)
+		})
+
+		Convey("Every other problem is also returned", func() {
+			c.Path = "api"
+			err := ValidateCookie(c)
+			So(errors.Is(err, ErrInsecureSameSiteNone), ShouldBeTrue)
+			So(errors.Is(err, ErrInvalidCookiePath), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a cookie with an invalid value", t, func() {
+		c := &http.Cookie{Name: "a", Value: "a;b"}
+
+		Convey("ErrInvalidCookie is returned", func() {
+			So(errors.Is(ValidateCookie(c), ErrInvalidCookie), ShouldBeTrue)
+		})
+	})
+}
+
+func TestValidateCookieForRequest(t *testing.T) {
+	Convey("Given a request to www.ons.gov.uk", t, func() {
+		req := httptest.NewRequest("GET", "https://www.ons.gov.uk:443/", http.NoBody)
+
+		Convey("Cookies for the host, a parent domain or with no domain are valid", func() {
+			for _, domain := range []string{"", "www.ons.gov.uk", "WWW.ONS.GOV.UK", "ons.gov.uk", ".ons.gov.uk"} {
+				So(ValidateCookieForRequest(req, &http.Cookie{Name: "a", Domain: domain}), ShouldBeNil)
+			}
+		})
+
+		Convey("Cookies for other domains are invalid", func() {
+			for _, domain := range []string{"cy.ons.gov.uk", "evil.com", "ww.ons.gov.uk"} {
+				So(errors.Is(ValidateCookieForRequest(req, &http.Cookie{Name: "a", Domain: domain}), ErrInvalidCookieDomain), ShouldBeTrue)
+			}
+		})
+	})
+
+	Convey("Given a request to an IP address", t, func() {
+		req := httptest.NewRequest("GET", "http://10.0.0.1/", http.NoBody)
+
+		Convey("Only cookies for the IP address are valid", func() {
+			So(ValidateCookieForRequest(req, &http.Cookie{Name: "a", Domain: "10.0.0.1"}), ShouldBeNil)
+			So(errors.Is(ValidateCookieForRequest(req, &http.Cookie{Name: "a", Domain: "0.0.1"}), ErrInvalidCookieDomain), ShouldBeTrue)
+		})
+	})
+}
+
+func TestCheckResponseCookieBudget(t *testing.T) {
+	Convey("Given a response with the cookies set by the consent handler", t, func() {
+		rec := httptest.NewRecorder()
+		SetONSPolicy(rec, ONSPolicy{Essential: true, Usage: true}, "www.ons.gov.uk")
+		SetONSPreferenceIsSet(rec, "www.ons.gov.uk")
+
+		Convey("They are within the default budget", func() {
+			So(CheckResponseCookieBudget(rec.Header(), DefaultResponseCookieBudget), ShouldBeNil)
+		})
+
+		Convey("A smaller budget is exceeded", func() {
+			err := CheckResponseCookieBudget(rec.Header(), 100)
+			So(errors.Is(err, ErrCookieBudgetExceeded), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given several large cookies which are each valid", t, func() {
+		rec := httptest.NewRecorder()
+		for _, name := range []string{"a", "b", "c"} {
+			SetCollection(rec, strings.Repeat(name, 3000), "www.ons.gov.uk")
+		}
+
+		Convey("Together they exceed the default budget", func() {
+			So(rec.Header().Values("Set-Cookie"), ShouldHaveLength, 3)
+			So(errors.Is(CheckResponseCookieBudget(rec.Header(), DefaultResponseCookieBudget), ErrCookieBudgetExceeded), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSetterValidation(t *testing.T) {
+	Convey("Given a value which would make the cookie too large", t, func() {
+		rec := httptest.NewRecorder()
+		SetCollection(rec, strings.Repeat("a", MaxCookieSize), "www.ons.gov.uk")
+
+		Convey("The cookie is not set", func() {
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an invalid domain", t, func() {
+		rec := httptest.NewRecorder()
+		SetLang(rec, "cy", "www.ons.gov.uk:8080")
+
+		Convey("The cookie is not set, rather than set without a domain", func() {
+			So(rec.Header().Values("Set-Cookie"), ShouldBeEmpty)
+		})
+	})
+}
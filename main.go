@@ -1,8 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ONSdigital/dp-cookies/cookies"
 )
@@ -24,9 +31,8 @@ func main() {
 	http.HandleFunc("/set-cookies", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("Setting all cookies")
 		cookies.SetPolicy(w, policy, domain) //nolint:staticcheck // To be removed in future iteration
-		cookies.SetONSPolicy(w, ONSPolicy, domain)
+		cookies.SetONSConsent(w, r, ONSPolicy, domain)
 		cookies.SetPreferenceIsSet(w, domain) //nolint:staticcheck // To be removed in future iteration
-		cookies.SetONSPreferenceIsSet(w, domain)
 		cookies.SetLang(w, "en", domain)
 		cookies.SetCollection(w, "test-collection-id-123456789", domain)
 		cookies.SetUserAuthToken(w, "test-user-auth-token", domain)
@@ -91,6 +97,256 @@ func main() {
 		}
 	})
 
+	http.Handle("/consent", cookies.NewConsentHandler(domain))
+	http.Handle("/set-lang", cookies.NewLangHandler(domain))
+
+	metrics := cookies.NewPrometheusMetrics()
+	cookies.SetMetricsCollector(metrics)
+	http.Handle("/metrics", metrics)
+
+	http.HandleFunc("/ab-test", func(w http.ResponseWriter, r *http.Request) {
+		aspects, err := cookies.GetABTestCookieAspects(r)
+		if err != nil && !errors.Is(err, cookies.ErrABTestCookieNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		ids := make([]string, 0, len(aspects))
+		for id := range aspects {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		preview := abTestPreview{Now: cookies.CookieTime{Time: now}, Aspects: make([]abTestAspectPreview, 0, len(ids))}
+		for _, id := range ids {
+			preview.Aspects = append(preview.Aspects, abTestAspectPreview{
+				ID:      id,
+				New:     aspects[id].New,
+				Old:     aspects[id].Old,
+				Variant: aspects[id].Variant(now),
+			})
+		}
+		render(w, r, abTestTemplate, preview)
+	})
+
+	http.HandleFunc("/ab-test/set", func(w http.ResponseWriter, r *http.Request) {
+		aspectID := r.URL.Query().Get("aspect")
+		if aspectID == "" {
+			http.Error(w, "missing 'aspect' query parameter", http.StatusBadRequest)
+			return
+		}
+
+		aspect, err := aspectFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cookies.SetABTestCookieAspect(w, r, aspectID, domain, aspect)
+		http.Redirect(w, r, "/ab-test?"+formatQuery(r), http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/ab-test/clear", func(w http.ResponseWriter, r *http.Request) {
+		aspectID := r.URL.Query().Get("aspect")
+		if aspectID == "" {
+			http.Error(w, "missing 'aspect' query parameter", http.StatusBadRequest)
+			return
+		}
+
+		cookies.RemoveABTestCookieAspect(w, r, aspectID, domain)
+		http.Redirect(w, r, "/ab-test?"+formatQuery(r), http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/ab-test/handler", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		decision := abTestDecision{
+			AspectID: query.Get("aspect"),
+			Enabled:  query.Get("enabled") != "false",
+			Exit:     query.Get("exit"),
+		}
+		if decision.AspectID == "" {
+			http.Error(w, "missing 'aspect' query parameter", http.StatusBadRequest)
+			return
+		}
+		if decision.Exit == "" {
+			decision.Exit = "exit-new"
+		}
+		if p := query.Get("percentage"); p != "" {
+			percentage, err := strconv.Atoi(p)
+			if err != nil {
+				http.Error(w, "invalid 'percentage' query parameter: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			decision.Percentage = percentage
+		}
+
+		decision.resolve(r, time.Now())
+		render(w, r, abTestDecisionTemplate, decision)
+	})
+
 	fmt.Println("Running on port 22888")
 	http.ListenAndServe(":22888", nil) //nolint:all // local dev server
 }
+
+// abTestPreview is the decoded content of the ab_test cookie as shown by the /ab-test debug route
+type abTestPreview struct {
+	Now     cookies.CookieTime    `json:"now"`
+	Aspects []abTestAspectPreview `json:"aspects"`
+}
+
+type abTestAspectPreview struct {
+	ID      string                `json:"id"`
+	New     cookies.CookieTime    `json:"new"`
+	Old     cookies.CookieTime    `json:"old"`
+	Variant cookies.ABTestVariant `json:"variant"`
+}
+
+// abTestDecision describes the handler cookies.Handler would pick for the current request
+type abTestDecision struct {
+	AspectID   string                `json:"aspect_id"`
+	Enabled    bool                  `json:"enabled"`
+	Percentage int                   `json:"percentage"`
+	Exit       string                `json:"exit"`
+	Variant    cookies.ABTestVariant `json:"variant"`
+	Reason     string                `json:"reason"`
+}
+
+// resolve mirrors the decision-making in cookies.Handler without setting any cookies or serving the request
+func (d *abTestDecision) resolve(r *http.Request, now time.Time) {
+	if !d.Enabled {
+		d.Variant, d.Reason = cookies.ABTestVariantNew, "a/b testing is disabled, the aspect will be purged and the new handler used"
+		return
+	}
+
+	if _, ok := r.URL.Query()[d.Exit]; ok {
+		d.Variant, d.Reason = cookies.ABTestVariantOld, "the exit query parameter is present"
+		return
+	}
+
+	if effective := cookies.GetEffectiveONSPolicy(r); effective.FromPrivacySignal() && !effective.Allows(cookies.CategoryUsage) {
+		d.Variant, d.Reason = cookies.ABTestVariantNew, fmt.Sprintf("usage cookies are rejected by %s, the new handler is used without an aspect", effective.Source)
+		return
+	}
+
+	aspect := cookies.GetABTestCookieAspect(r, d.AspectID)
+	if variant := aspect.Variant(now); variant != cookies.ABTestVariantNone {
+		d.Variant, d.Reason = variant, "the aspect in the ab_test cookie is still valid"
+		return
+	}
+
+	d.Variant = cookies.ABTestVariantNone
+	d.Reason = fmt.Sprintf("the aspect is missing or expired, a new one will be randomised with a %d%% chance of the new handler", d.Percentage)
+}
+
+// aspectFromQuery builds an aspect from either a forced 'variant' or explicit 'new' and 'old' times
+func aspectFromQuery(r *http.Request) (cookies.ABTestCookieAspect, error) {
+	query := r.URL.Query()
+
+	lifetime := time.Hour * 24
+	if h := query.Get("hours"); h != "" {
+		hours, err := strconv.Atoi(h)
+		if err != nil {
+			return cookies.ABTestCookieAspect{}, fmt.Errorf("invalid 'hours' query parameter: %w", err)
+		}
+		lifetime = time.Hour * time.Duration(hours)
+	}
+
+	switch variant := cookies.ABTestVariant(query.Get("variant")); variant {
+	case cookies.ABTestVariantNew, cookies.ABTestVariantOld:
+		return cookies.NewABTestCookieAspect(variant, lifetime), nil
+	case "":
+	default:
+		return cookies.ABTestCookieAspect{}, fmt.Errorf("invalid 'variant' query parameter %q, expected 'new' or 'old'", variant)
+	}
+
+	newTime, err := cookies.ParseCookieTime(query.Get("new"))
+	if err != nil {
+		return cookies.ABTestCookieAspect{}, err
+	}
+	oldTime, err := cookies.ParseCookieTime(query.Get("old"))
+	if err != nil {
+		return cookies.ABTestCookieAspect{}, err
+	}
+
+	return cookies.ABTestCookieAspect{New: newTime, Old: oldTime}, nil
+}
+
+// formatQuery carries the requested output format across a redirect
+func formatQuery(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return "format=" + format
+	}
+	return ""
+}
+
+// render writes data as an HTML page when requested, and as JSON otherwise
+func render(w http.ResponseWriter, r *http.Request, tmpl *template.Template, data interface{}) {
+	format := r.URL.Query().Get("format")
+	if format == "html" || (format == "" && strings.Contains(r.Header.Get("Accept"), "text/html")) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var abTestTemplate = template.Must(template.New("ab-test").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><title>ab_test cookie</title></head>
+<body>
+<h1>ab_test cookie</h1>
+<p>Now: {{.Now}}</p>
+{{if .Aspects}}
+<table>
+<tr><th>Aspect</th><th>New</th><th>Old</th><th>Variant</th><th></th></tr>
+{{range .Aspects}}
+<tr>
+<td>{{.ID}}</td><td>{{.New}}</td><td>{{.Old}}</td><td>{{.Variant}}</td>
+<td>
+<a href="/ab-test/set?aspect={{.ID}}&variant=new&format=html">force new</a>
+<a href="/ab-test/set?aspect={{.ID}}&variant=old&format=html">force old</a>
+<a href="/ab-test/clear?aspect={{.ID}}&format=html">clear</a>
+<a href="/ab-test/handler?aspect={{.ID}}&format=html">handler</a>
+</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No aspects are set.</p>
+{{end}}
+<form action="/ab-test/set">
+<input type="hidden" name="format" value="html">
+<label>Aspect <input name="aspect"></label>
+<label>Variant <select name="variant"><option>new</option><option>old</option></select></label>
+<label>Hours <input name="hours" value="24"></label>
+<button type="submit">Set</button>
+</form>
+</body>
+</html>
+`))
+
+var abTestDecisionTemplate = template.Must(template.New("ab-test-handler").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><title>ab_test handler</title></head>
+<body>
+<h1>Handler decision for {{.AspectID}}</h1>
+<dl>
+<dt>A/B testing enabled</dt><dd>{{.Enabled}}</dd>
+<dt>Percentage</dt><dd>{{.Percentage}}</dd>
+<dt>Exit parameter</dt><dd>{{.Exit}}</dd>
+<dt>Variant</dt><dd>{{.Variant}}</dd>
+<dt>Reason</dt><dd>{{.Reason}}</dd>
+</dl>
+<p><a href="/ab-test?format=html">Back</a></p>
+</body>
+</html>
+`))